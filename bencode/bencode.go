@@ -3,9 +3,11 @@ package bencode
 import (
 	"bytes"
 	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"regexp"
 	"strconv"
+	"time"
 )
 
 const (
@@ -23,6 +25,16 @@ const (
 	mainAnnounceKey       = "announce"
 	announceListKey       = "announce-list"
 	torrentDictOffsetsKey = "byte_offsets"
+	torrentPiecesKey      = "pieces"
+	torrentPathKey        = "path"
+	torrentPrivateKey     = "private"
+	torrentSourceKey      = "source"
+	createdByKey          = "created by"
+	creationDateKey       = "creation date"
+	commentKey            = "comment"
+	urlListKey            = "url-list"
+
+	pieceHashLength = 20
 )
 
 // TorrentInfo contains all relevant information extracted from a bencode file
@@ -32,45 +44,89 @@ type TorrentInfo struct {
 	TotalSize          int
 	TrackerInfo        *TrackerInfo
 	InfoHashURLEncoded string
+	InfoHash           [20]byte
+	// Files has a single entry named after the torrent for single file torrents
+	Files        []File
+	PieceCount   int
+	Private      bool
+	CreatedBy    string
+	CreationDate time.Time
+	Comment      string
+	Source       string
+	WebSeeds     []string
+	// piecesLength is the length of the pieces hashes, kept to validate parsed torrents
+	piecesLength int
+}
+
+// File is a file of the torrent, Path holds the directories and the file name
+type File struct {
+	Path   []string
+	Length int
 }
 
 //TrackerInfo contains http urls from the tracker
 type TrackerInfo struct {
 	Main string
 	Urls []string
+	// Tiers keeps the announce-list structure as described in BEP 12, when there is no announce-list the
+	// main announce is the only tier
+	Tiers [][]string
 }
 
 type torrentDict struct {
 	resultMap map[string]interface{}
 }
 
-//TorrentDictParse decodes the bencoded bytes and builds the torrentInfo file
+//TorrentDictParse decodes the bencoded bytes and builds the torrentInfo file, call Validate on the
+//result to check it can be announced
 func TorrentDictParse(dat []byte) (torrent *TorrentInfo, err error) {
 	defer func() {
 		if e := recover(); e != nil {
-			err = e.(error)
+			torrent = nil
+			err = fmt.Errorf("invalid bencoded torrent: %v", e)
 		}
 	}()
 
 	dict, _ := mapParse(0, &dat)
 	torrentMap := torrentDict{resultMap: dict}
+	infoHash := torrentMap.extractInfoHash(dat)
+	info := torrentMap.resultMap[torrentInfoKey].(map[string]interface{})
+	pieces, _ := info[torrentPiecesKey].(string)
+	private, _ := info[torrentPrivateKey].(int)
 	return &TorrentInfo{
-		Name:               torrentMap.resultMap[torrentInfoKey].(map[string]interface{})[torrentNameKey].(string),
-		PieceSize:          torrentMap.resultMap[torrentInfoKey].(map[string]interface{})[torrentPieceLengthKey].(int),
+		Name:               info[torrentNameKey].(string),
+		PieceSize:          info[torrentPieceLengthKey].(int),
 		TotalSize:          torrentMap.extractTotalSize(),
 		TrackerInfo:        torrentMap.extractTrackerInfo(),
-		InfoHashURLEncoded: torrentMap.extractInfoHashURLEncoded(dat),
+		InfoHashURLEncoded: URLEncodeInfoHash(infoHash[:]),
+		InfoHash:           infoHash,
+		Files:              torrentMap.extractFiles(),
+		PieceCount:         len(pieces) / pieceHashLength,
+		Private:            private == 1,
+		CreatedBy:          torrentMap.stringValue(createdByKey),
+		CreationDate:       torrentMap.extractCreationDate(),
+		Comment:            torrentMap.stringValue(commentKey),
+		Source:             stringValue(info, torrentSourceKey),
+		WebSeeds:           torrentMap.extractWebSeeds(),
+		piecesLength:       len(pieces),
 	}, err
 }
 
-func (t *torrentDict) extractInfoHashURLEncoded(rawData []byte) string {
+// InfoHashHex is the info hash as shown by clients and written in magnet links
+func (t *TorrentInfo) InfoHashHex() string {
+	return hex.EncodeToString(t.InfoHash[:])
+}
+
+func (t *torrentDict) extractInfoHash(rawData []byte) [20]byte {
 	byteOffsets := t.resultMap["info"].(map[string]interface{})["byte_offsets"].([]int)
-	h := sha1.New()
-	h.Write([]byte(rawData[byteOffsets[0]:byteOffsets[1]]))
-	ret := h.Sum(nil)
+	return sha1.Sum(rawData[byteOffsets[0]:byteOffsets[1]])
+}
+
+//URLEncodeInfoHash percent-encodes the raw info hash bytes the way it is sent to the tracker
+func URLEncodeInfoHash(infoHash []byte) string {
 	var buf bytes.Buffer
 	re := regexp.MustCompile(`[a-zA-Z0-9\.\-\_\~]`)
-	for _, b := range ret {
+	for _, b := range infoHash {
 		if re.Match([]byte{b}) {
 			buf.WriteByte(b)
 		} else {
@@ -92,6 +148,64 @@ func (t *torrentDict) extractTotalSize() int {
 	return total
 }
 
+func (t *torrentDict) extractFiles() []File {
+	info := t.resultMap[torrentInfoKey].(map[string]interface{})
+	list, ok := info[torrentFilesKey].([]interface{})
+	if !ok {
+		length, _ := info[torrentLengthKey].(int)
+		return []File{{Path: []string{info[torrentNameKey].(string)}, Length: length}}
+	}
+	files := make([]File, 0, len(list))
+	for _, item := range list {
+		file, _ := item.(map[string]interface{})
+		length, _ := file[torrentLengthKey].(int)
+		var path []string
+		parts, _ := file[torrentPathKey].([]interface{})
+		for _, part := range parts {
+			if s, ok := part.(string); ok {
+				path = append(path, s)
+			}
+		}
+		files = append(files, File{Path: path, Length: length})
+	}
+	return files
+}
+
+func (t *torrentDict) extractCreationDate() time.Time {
+	if date, ok := t.resultMap[creationDateKey].(int); ok && date > 0 {
+		return time.Unix(int64(date), 0).UTC()
+	}
+	return time.Time{}
+}
+
+// extractWebSeeds reads the BEP 19 url-list, a single url or a list of them
+func (t *torrentDict) extractWebSeeds() []string {
+	switch urls := t.resultMap[urlListKey].(type) {
+	case string:
+		if urls != "" {
+			return []string{urls}
+		}
+	case []interface{}:
+		var seeds []string
+		for _, u := range urls {
+			if s, ok := u.(string); ok && s != "" {
+				seeds = append(seeds, s)
+			}
+		}
+		return seeds
+	}
+	return nil
+}
+
+func (t *torrentDict) stringValue(key string) string {
+	return stringValue(t.resultMap, key)
+}
+
+func stringValue(dict map[string]interface{}, key string) string {
+	value, _ := dict[key].(string)
+	return value
+}
+
 func (t *torrentDict) extractTrackerInfo() *TrackerInfo {
 	uniqueUrls := make(map[string]int)
 	currentCount := 0
@@ -112,20 +226,47 @@ func (t *torrentDict) extractTrackerInfo() *TrackerInfo {
 		}
 
 	}
-	trackerInfo := TrackerInfo{Urls: make([]string, len(uniqueUrls))}
+	trackerInfo := TrackerInfo{Urls: make([]string, len(uniqueUrls)), Tiers: t.extractTrackerTiers()}
 	for key, value := range uniqueUrls {
 		trackerInfo.Urls[value] = key
 	}
 
-	trackerInfo.Main = trackerInfo.Urls[0]
+	if len(trackerInfo.Urls) > 0 {
+		trackerInfo.Main = trackerInfo.Urls[0]
+	}
 	return &trackerInfo
 }
 
+func (t *torrentDict) extractTrackerTiers() [][]string {
+	var tiers [][]string
+	seen := make(map[string]bool)
+	if list, ok := t.resultMap[announceListKey]; ok {
+		for _, innerList := range list.([]interface{}) {
+			var tier []string
+			for _, item := range innerList.([]interface{}) {
+				if !seen[item.(string)] {
+					seen[item.(string)] = true
+					tier = append(tier, item.(string))
+				}
+			}
+			if len(tier) > 0 {
+				tiers = append(tiers, tier)
+			}
+		}
+	}
+	if len(tiers) == 0 {
+		if main, ok := t.resultMap[mainAnnounceKey]; ok {
+			tiers = append(tiers, []string{main.(string)})
+		}
+	}
+	return tiers
+}
+
 //Decode accepts a byte slice and returns a map with information parsed.
 func Decode(data []byte) (dataMap map[string]interface{}, err error) {
 	defer func() {
 		if e := recover(); e != nil {
-			err = e.(error)
+			err = fmt.Errorf("invalid bencoded data: %v", e)
 		}
 	}()
 
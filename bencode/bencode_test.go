@@ -5,6 +5,7 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func assertAreEqual(t *testing.T, got, want interface{}) {
@@ -112,3 +113,59 @@ func TestDecode(T *testing.T) {
 	}
 
 }
+
+func TestExtractTrackerTiers(T *testing.T) {
+	T.Run("announce-list tiers are kept and deduplicated", func(t *testing.T) {
+		dict := torrentDict{resultMap: map[string]interface{}{
+			mainAnnounceKey: "http://a",
+			announceListKey: []interface{}{
+				[]interface{}{"http://a", "http://b"},
+				[]interface{}{"http://b"},
+				[]interface{}{"http://c", "http://d"},
+			},
+		}}
+		got := dict.extractTrackerTiers()
+		want := [][]string{{"http://a", "http://b"}, {"http://c", "http://d"}}
+		assertAreEqualDeep(t, got, want)
+	})
+	T.Run("main announce is the only tier without announce-list", func(t *testing.T) {
+		dict := torrentDict{resultMap: map[string]interface{}{mainAnnounceKey: "http://a"}}
+		got := dict.extractTrackerTiers()
+		want := [][]string{{"http://a"}}
+		assertAreEqualDeep(t, got, want)
+	})
+}
+
+func TestTorrentDictParseMetadata(T *testing.T) {
+	T.Run("single file torrent", func(t *testing.T) {
+		data, _ := os.ReadFile("./torrent_files_test/debian-12.0.0-amd64-DVD-1.iso.torrent")
+		got, err := TorrentDictParse(data)
+		if err != nil {
+			t.Fatalf("should not return error: %v", err)
+		}
+		assertAreEqual(t, got.InfoHashHex(), "b1680a55cfc8693c6c02de732dd17c33e251e8e5")
+		assertAreEqual(t, got.InfoHashURLEncoded, URLEncodeInfoHash(got.InfoHash[:]))
+		assertAreEqualDeep(t, got.Files, []File{{Path: []string{"debian-12.0.0-amd64-DVD-1.iso"}, Length: 3931095040}})
+		assertAreEqual(t, got.PieceCount, 14996)
+		assertAreEqual(t, got.Private, false)
+		assertAreEqual(t, got.CreatedBy, "mktorrent 1.1")
+		assertAreEqual(t, got.CreationDate, time.Date(2023, 6, 10, 12, 1, 18, 0, time.UTC))
+		assertAreEqual(t, got.Comment, `"Debian CD from cdimage.debian.org"`)
+		assertAreEqual(t, len(got.WebSeeds), 2)
+	})
+	T.Run("private multi file torrent", func(t *testing.T) {
+		data := []byte("d8:announce8:http://a10:created by4:test4:infod5:filesld6:lengthi10e4:pathl3:dir5:a.txteed6:lengthi20e4:pathl5:b.txteee4:name4:root12:piece lengthi16384e6:pieces20:xxxxxxxxxxxxxxxxxxxx7:privatei1e6:source3:SRCe8:url-list8:http://se")
+		got, err := TorrentDictParse(data)
+		if err != nil {
+			t.Fatalf("should not return error: %v", err)
+		}
+		assertAreEqualDeep(t, got.Files, []File{{Path: []string{"dir", "a.txt"}, Length: 10}, {Path: []string{"b.txt"}, Length: 20}})
+		assertAreEqual(t, got.TotalSize, 30)
+		assertAreEqual(t, got.PieceCount, 1)
+		assertAreEqual(t, got.Private, true)
+		assertAreEqual(t, got.Source, "SRC")
+		assertAreEqual(t, got.CreatedBy, "test")
+		assertAreEqual(t, got.CreationDate.IsZero(), true)
+		assertAreEqualDeep(t, got.WebSeeds, []string{"http://s"})
+	})
+}
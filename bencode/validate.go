@@ -0,0 +1,54 @@
+package bencode
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidationError lists every problem found in a torrent
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid torrent: " + strings.Join(e.Problems, ", ")
+}
+
+// Validate checks a parsed torrent is consistent enough to be announced, it returns a
+// *ValidationError with every problem found
+func (t *TorrentInfo) Validate() error {
+	var problems []string
+	if t.PieceSize <= 0 || t.PieceSize&(t.PieceSize-1) != 0 {
+		problems = append(problems, fmt.Sprintf("piece length %d is not a power of two", t.PieceSize))
+	}
+	if t.piecesLength%pieceHashLength != 0 {
+		problems = append(problems, fmt.Sprintf("pieces length %d is not a multiple of %d", t.piecesLength, pieceHashLength))
+	} else if t.PieceSize > 0 {
+		if want := (t.TotalSize + t.PieceSize - 1) / t.PieceSize; t.PieceCount != want {
+			problems = append(problems, fmt.Sprintf("%d pieces found where the size needs %d", t.PieceCount, want))
+		}
+	}
+	if len(t.Files) == 0 {
+		problems = append(problems, "file list is empty")
+	}
+	if t.TotalSize <= 0 {
+		problems = append(problems, "torrent size is zero")
+	}
+	if t.Private && (t.TrackerInfo == nil || len(t.TrackerInfo.Urls) == 0) {
+		problems = append(problems, "private torrent has no announce url")
+	}
+	if !utf8.ValidString(t.Name) {
+		problems = append(problems, fmt.Sprintf("name %q is not valid UTF-8", t.Name))
+	}
+	for _, f := range t.Files {
+		if path := strings.Join(f.Path, "/"); !utf8.ValidString(path) {
+			problems = append(problems, fmt.Sprintf("file path %q is not valid UTF-8", path))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package bencode
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestValidate(T *testing.T) {
+	pieces := func(n int) string {
+		return "6:pieces" + strconv.Itoa(n*20) + ":" + strings.Repeat("x", n*20)
+	}
+	data := []struct {
+		name    string
+		torrent string
+		want    []string
+	}{
+		{
+			name:    "valid torrent",
+			torrent: "d8:announce8:http://a4:infod6:lengthi20000e4:name1:a12:piece lengthi16384e" + pieces(2) + "ee",
+		},
+		{
+			name:    "piece length not a power of two",
+			torrent: "d8:announce8:http://a4:infod6:lengthi20000e4:name1:a12:piece lengthi10000e" + pieces(2) + "ee",
+			want:    []string{"piece length 10000 is not a power of two"},
+		},
+		{
+			name:    "pieces length not a multiple of 20",
+			torrent: "d8:announce8:http://a4:infod6:lengthi20000e4:name1:a12:piece lengthi16384e6:pieces3:abcee",
+			want:    []string{"pieces length 3 is not a multiple of 20"},
+		},
+		{
+			name:    "pieces inconsistent with the size",
+			torrent: "d8:announce8:http://a4:infod6:lengthi20000e4:name1:a12:piece lengthi16384e" + pieces(3) + "ee",
+			want:    []string{"3 pieces found where the size needs 2"},
+		},
+		{
+			name:    "empty file list",
+			torrent: "d8:announce8:http://a4:infod5:filesle4:name1:a12:piece lengthi16384e6:pieces0:ee",
+			want:    []string{"file list is empty", "torrent size is zero"},
+		},
+		{
+			name:    "zero length torrent",
+			torrent: "d8:announce8:http://a4:infod6:lengthi0e4:name1:a12:piece lengthi16384e6:pieces0:ee",
+			want:    []string{"torrent size is zero"},
+		},
+		{
+			name:    "private torrent without announce",
+			torrent: "d4:infod6:lengthi20000e4:name1:a12:piece lengthi16384e" + pieces(2) + "7:privatei1eee",
+			want:    []string{"private torrent has no announce url"},
+		},
+		{
+			name:    "non UTF-8 names",
+			torrent: "d8:announce8:http://a4:infod5:filesld6:lengthi20000e4:pathl2:\xff\xfeeee4:name1:\xe912:piece lengthi16384e" + pieces(2) + "ee",
+			want:    []string{`name "\xe9" is not valid UTF-8`, `file path "\xff\xfe" is not valid UTF-8`},
+		},
+	}
+	for _, td := range data {
+		T.Run(td.name, func(t *testing.T) {
+			torrent, err := TorrentDictParse([]byte(td.torrent))
+			if err != nil {
+				t.Fatalf("should not return error: %v", err)
+			}
+			err = torrent.Validate()
+			if td.want == nil {
+				if err != nil {
+					t.Errorf("should not return error: %v", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("got: %v want a validation error", err)
+			}
+			if !reflect.DeepEqual(validationErr.Problems, td.want) {
+				t.Errorf("got: %q want %q", validationErr.Problems, td.want)
+			}
+		})
+	}
+
+	T.Run("test torrents are valid", func(t *testing.T) {
+		data, _ := os.ReadFile("./torrent_files_test/debian-12.0.0-amd64-DVD-1.iso.torrent")
+		torrent, _ := TorrentDictParse(data)
+		if err := torrent.Validate(); err != nil {
+			t.Errorf("should not return error: %v", err)
+		}
+	})
+}
+
+func TestTorrentDictParseErrors(T *testing.T) {
+	data := []string{
+		"",
+		"d8:announce8:http://ae",
+		"d4:infod4:name1:aee",
+		"x",
+	}
+	for _, td := range data {
+		torrent, err := TorrentDictParse([]byte(td))
+		if err == nil || torrent != nil || !strings.HasPrefix(err.Error(), "invalid bencoded torrent") {
+			T.Errorf("%q: got: %v %v", td, torrent, err)
+		}
+	}
+}
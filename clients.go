@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"ratio-spoof/emulation"
+	"text/tabwriter"
+)
+
+func runClients(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "import":
+			return runClientsImport(args[1:])
+		case "diff":
+			return runClientsDiff(args[1:])
+		}
+	}
+
+	flags := flag.NewFlagSet("clients", flag.ExitOnError)
+	profilesDir := flags.String("profiles", emulation.DefaultProfilesDir(), "directory searched for JSON profiles before the embedded ones")
+	flags.Usage = func() {
+		fmt.Printf("usage: %s clients [-profiles DIR]\n", os.Args[0])
+		fmt.Printf("       %s clients import [-o FILE] <CAPTURE|->\n", os.Args[0])
+		fmt.Printf("       %s clients diff [-profiles DIR] <CLIENT_CODE> <CLIENT_CODE>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	profiles, err := emulation.ListProfiles(*profilesDir)
+	if err != nil {
+		fmt.Printf("Error listing the clients: %v\n", err)
+		return exitSetupError
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CODE\tNAME\tORIGIN")
+	for _, p := range profiles {
+		name := p.Name
+		if p.Err != nil {
+			name = p.Err.Error()
+		}
+		origin := p.Origin
+		if p.Overrides {
+			origin += " (overrides embedded)"
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\n", p.Code, name, origin)
+	}
+	w.Flush()
+	return 0
+}
+
+// runClientsImport writes the profile of a captured announce request, the warnings and validation
+// problems go to the standard error so the profile can be redirected to a file
+func runClientsImport(args []string) int {
+	flags := flag.NewFlagSet("clients import", flag.ExitOnError)
+	output := flags.String("o", "", "file the profile is written to instead of the standard output")
+	flags.Usage = func() {
+		fmt.Printf("usage: %s clients import [-o FILE] <CAPTURE|->\n", os.Args[0])
+		fmt.Println("CAPTURE is a raw http announce request or a HAR file, - reads the standard input")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitSetupError
+	}
+
+	var data []byte
+	var err error
+	if flags.Arg(0) == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(flags.Arg(0))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading the capture: %v\n", err)
+		return exitSetupError
+	}
+	capture, err := emulation.ParseCapture(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing the capture: %v\n", err)
+		return exitSetupError
+	}
+	profile, warnings := capture.Profile()
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing the profile: %v\n", err)
+			return exitFailed
+		}
+		defer out.Close()
+	}
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(profile); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing the profile: %v\n", err)
+		return exitFailed
+	}
+
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+	if err := profile.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "The imported profile needs changes: %v\n", err)
+		return exitSetupError
+	}
+	return 0
+}
+
+func runClientsDiff(args []string) int {
+	flags := flag.NewFlagSet("clients diff", flag.ExitOnError)
+	profilesDir := flags.String("profiles", emulation.DefaultProfilesDir(), "directory searched for JSON profiles before the embedded ones")
+	flags.Usage = func() {
+		fmt.Printf("usage: %s clients diff [-profiles DIR] <CLIENT_CODE> <CLIENT_CODE>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return exitSetupError
+	}
+
+	a, err := emulation.LoadClientInfo(flags.Arg(0), *profilesDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", flags.Arg(0), err)
+		return exitSetupError
+	}
+	b, err := emulation.LoadClientInfo(flags.Arg(1), *profilesDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", flags.Arg(1), err)
+		return exitSetupError
+	}
+
+	differences := emulation.Diff(a, b)
+	for _, d := range differences {
+		fmt.Printf("%s\n\t%s: %s\n\t%s: %s\n", d.Field, flags.Arg(0), d.A, flags.Arg(1), d.B)
+	}
+	if len(differences) > 0 {
+		fmt.Printf("%v differences found\n", len(differences))
+		return exitFailed
+	}
+	fmt.Println("no differences found")
+	return 0
+}
@@ -0,0 +1,189 @@
+package emulation
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	generator2 "ratio-spoof/generator"
+	"regexp"
+	"strings"
+)
+
+// Capture is an announce request captured from a real client
+type Capture struct {
+	URL     *url.URL
+	Headers map[string]string
+}
+
+// captureParams maps the announce parameters to the placeholders replacing their captured values
+var captureParams = map[string]string{
+	"info_hash":  "{infohash}",
+	"peer_id":    "{peerid}",
+	"port":       "{port}",
+	"uploaded":   "{uploaded}",
+	"downloaded": "{downloaded}",
+	"left":       "{left}",
+	"key":        "{key}",
+	"event":      "{event?}",
+	"numwant":    "{numwant}",
+	"ip":         "{ip?}",
+	"ipv4":       "{ipv4?}",
+	"ipv6":       "{ipv6?}",
+}
+
+// ignoredCaptureHeaders are set by the http client itself
+var ignoredCaptureHeaders = map[string]bool{"Host": true, "Content-Length": true, "Connection": true}
+
+var (
+	azureusPeerIdPrefix = regexp.MustCompile(`^-[A-Za-z~][A-Za-z0-9~]{5}-`)
+	hexKey              = regexp.MustCompile(`^[0-9A-F]+$`)
+)
+
+// charClasses are tried from the narrowest to describe the random part of the captured peer ids and keys
+var charClasses = []struct {
+	class string
+	match *regexp.Regexp
+}{
+	{`[0-9a-f]`, regexp.MustCompile(`^[0-9a-f]*$`)},
+	{`[0-9a-z]`, regexp.MustCompile(`^[0-9a-z]*$`)},
+	{`[A-Za-z0-9]`, regexp.MustCompile(`^[A-Za-z0-9]*$`)},
+	{`[A-Za-z0-9_~\(\)\!\.\*-]`, regexp.MustCompile(`^[A-Za-z0-9_~()!.*-]*$`)},
+}
+
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				URL     string `json:"url"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// ParseCapture reads a raw http announce request, as written by a proxy log, or the first announce of
+// a HAR file
+func ParseCapture(data []byte) (*Capture, error) {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		return parseHAR(trimmed)
+	}
+	// the blank line ending the headers is often left out when copying a request
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(append(trimmed, "\r\n\r\n"...))))
+	if err != nil {
+		return nil, fmt.Errorf("invalid http request: %w", err)
+	}
+	capture := &Capture{URL: req.URL, Headers: make(map[string]string)}
+	for name, values := range req.Header {
+		capture.Headers[name] = strings.Join(values, ", ")
+	}
+	return capture, nil
+}
+
+func parseHAR(data []byte) (*Capture, error) {
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("invalid HAR file: %w", err)
+	}
+	for _, entry := range har.Log.Entries {
+		u, err := url.Parse(entry.Request.URL)
+		if err != nil || !strings.Contains(u.RawQuery, "info_hash=") {
+			continue
+		}
+		capture := &Capture{URL: u, Headers: make(map[string]string)}
+		for _, h := range entry.Request.Headers {
+			// http/2 pseudo headers such as :authority
+			if strings.HasPrefix(h.Name, ":") {
+				continue
+			}
+			capture.Headers[http.CanonicalHeaderKey(h.Name)] = h.Value
+		}
+		return capture, nil
+	}
+	return nil, errors.New("HAR file has no announce request")
+}
+
+// Profile builds the profile sending the captured request, the announce values are replaced by their
+// placeholders and the peer id and key generators are guessed from the captured values. The returned
+// warnings tell what a single capture can not show
+func (c *Capture) Profile() (*ClientInfo, []string) {
+	var warnings []string
+	profile := &ClientInfo{
+		Name:     c.Headers["User-Agent"],
+		Rounding: generator2.Config{Generator: generator2.DefaultRounding},
+		Headers:  make(map[string]string),
+	}
+	for name, value := range c.Headers {
+		if !ignoredCaptureHeaders[name] {
+			profile.Headers[name] = value
+		}
+	}
+
+	var params []string
+	found := make(map[string]bool)
+	for _, pair := range strings.Split(c.URL.RawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		placeholder, ok := captureParams[name]
+		if !ok {
+			params = append(params, pair)
+			continue
+		}
+		found[name] = true
+		params = append(params, name+"="+placeholder)
+		decoded, err := url.PathUnescape(value)
+		if err != nil {
+			decoded = value
+		}
+		switch name {
+		case "peer_id":
+			profile.PeerID = generator2.Config{Regex: peerIdRegex(decoded)}
+		case "key":
+			profile.Key = keyConfig(decoded)
+		}
+	}
+	profile.Query = strings.Join(params, "&")
+
+	if !found["event"] {
+		warnings = append(warnings, "the capture has no event, add event={event?} where the client sends it")
+	}
+	if !found["key"] {
+		profile.Key = generator2.Config{Generator: generator2.DefaultKey}
+		warnings = append(warnings, "the capture has no key, the key generator is unused")
+	}
+	return profile, warnings
+}
+
+// peerIdRegex keeps the client prefix of an azureus style peer id and matches the rest with the
+// characters seen in it
+func peerIdRegex(peerId string) string {
+	prefix := azureusPeerIdPrefix.FindString(peerId)
+	random := peerId[len(prefix):]
+	return regexp.QuoteMeta(prefix) + fmt.Sprintf("%s{%d}", charClass(random), len(random))
+}
+
+func keyConfig(key string) generator2.Config {
+	if hexKey.MatchString(key) {
+		return generator2.Config{Generator: generator2.HexKey, Length: len(key)}
+	}
+	return generator2.Config{Generator: generator2.RegexKey, Regex: fmt.Sprintf("%s{%d}", charClass(key), len(key))}
+}
+
+func charClass(value string) string {
+	for _, c := range charClasses {
+		if c.match.MatchString(value) {
+			return c.class
+		}
+	}
+	// raw bytes can not be generated by a regex, the closest printable class is used
+	return `[A-Za-z0-9]`
+}
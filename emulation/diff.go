@@ -0,0 +1,111 @@
+package emulation
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// MissingValue is shown for what one of the compared profiles does not have
+const MissingValue = "<missing>"
+
+// Difference is a field that is not the same in two profiles
+type Difference struct {
+	Field string
+	A     string
+	B     string
+}
+
+// Diff compares the name, generators, query parameters, events and headers of two profiles
+func Diff(a, b *ClientInfo) []Difference {
+	var result []Difference
+	add := func(field, valueA, valueB string) {
+		if valueA != valueB {
+			result = append(result, Difference{Field: field, A: valueA, B: valueB})
+		}
+	}
+	add("name", a.Name, b.Name)
+	add("peer id", jsonString(a.PeerID), jsonString(b.PeerID))
+	add("key", jsonString(a.Key), jsonString(b.Key))
+	add("rounding", jsonString(a.Rounding), jsonString(b.Rounding))
+	result = append(result, DiffQuery(a.Query, b.Query)...)
+	add("events", eventsString(a.Events), eventsString(b.Events))
+	result = append(result, DiffHeaders(a.Headers, b.Headers)...)
+	return result
+}
+
+// DiffQuery compares the parameters of two queries and then their order when they are the same, it is
+// shared by the profile diff and the replay of recorded announces
+func DiffQuery(a, b string) []Difference {
+	if a == b {
+		return nil
+	}
+	keysA, valuesA := splitParams(a)
+	keysB, valuesB := splitParams(b)
+	result := diffMaps("query ", valuesA, valuesB)
+	if len(result) == 0 {
+		result = append(result, Difference{Field: "query order", A: strings.Join(keysA, "&"), B: strings.Join(keysB, "&")})
+	}
+	return result
+}
+
+func splitParams(query string) (keys []string, values map[string]string) {
+	values = make(map[string]string)
+	for _, pair := range strings.Split(query, "&") {
+		if pair == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(pair, "=")
+		keys = append(keys, k)
+		values[k] = v
+	}
+	return keys, values
+}
+
+// DiffHeaders compares two sets of headers by name
+func DiffHeaders(a, b map[string]string) []Difference {
+	return diffMaps("header ", a, b)
+}
+
+func diffMaps(prefix string, a, b map[string]string) []Difference {
+	keys := make(map[string]bool)
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var result []Difference
+	for _, k := range sorted {
+		valueA, okA := a[k]
+		valueB, okB := b[k]
+		if !okA {
+			valueA = MissingValue
+		}
+		if !okB {
+			valueB = MissingValue
+		}
+		if valueA != valueB {
+			result = append(result, Difference{Field: prefix + k, A: valueA, B: valueB})
+		}
+	}
+	return result
+}
+
+func jsonString(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func eventsString(events map[string]EventOverride) string {
+	if len(events) == 0 {
+		return MissingValue
+	}
+	return jsonString(events)
+}
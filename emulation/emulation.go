@@ -3,38 +3,30 @@ package emulation
 import (
 	"embed"
 	"encoding/json"
+	"errors"
+	"fmt"
 	generator2 "ratio-spoof/generator"
-	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
 )
 
 type ClientInfo struct {
-	Name   string `json:"name"`
-	PeerID struct {
-		Generator string `json:"generator"`
-		Regex     string `json:"regex"`
-	} `json:"peerId"`
-	Key struct {
-		Generator string `json:"generator"`
-		Regex     string `json:"regex"`
-	} `json:"key"`
-	Rounding struct {
-		Generator string `json:"generator"`
-		Regex     string `json:"regex"`
-	} `json:"rounding"`
-	Query   string            `json:"query"`
-	Headers map[string]string `json:"headers"`
+	Name     string            `json:"name"`
+	PeerID   generator2.Config `json:"peerId"`
+	Key      generator2.Config `json:"key"`
+	Rounding generator2.Config `json:"rounding"`
+	Query    string            `json:"query"`
+	Headers  map[string]string `json:"headers"`
+	// Events overrides announce values by event name
+	Events map[string]EventOverride `json:"events,omitempty"`
 }
 
-type KeyGenerator interface {
-	Key() string
-}
+type KeyGenerator = generator2.KeyGenerator
 
-type PeerIdGenerator interface {
-	PeerId() string
-}
-type RoundingGenerator interface {
-	Round(downloadCandidateNextAmount, uploadCandidateNextAmount, leftCandidateNextAmount, pieceSize int) (downloaded, uploaded, left int)
-}
+type PeerIdGenerator = generator2.PeerIdGenerator
+
+type RoundingGenerator = generator2.RoundingGenerator
 
 type Emulation struct {
 	PeerIdGenerator
@@ -43,53 +35,117 @@ type Emulation struct {
 	Name    string
 	Headers map[string]string
 	RoundingGenerator
+	// Origin is EmbeddedOrigin or the path of the profile file
+	Origin string
+	Events map[string]EventOverride
+	// peerIdConfig and keyConfig generate new values following their lifecycle, see Identities
+	peerIdConfig generator2.Config
+	keyConfig    generator2.Config
+}
+
+// AnnounceValues holds the values substituted in the query template of an announce
+type AnnounceValues struct {
+	InfoHash   string
+	PeerId     string
+	Key        string
+	Port       int
+	Uploaded   int
+	Downloaded int
+	Left       int
+	Event      string
+	NumWant    int
+	// IP, IPv4 and IPv6 are the announced addresses, empty when not configured or detected
+	IP   string
+	IPv4 string
+	IPv6 string
 }
 
+// NewEmulation builds the emulation of an embedded client code or of a JSON profile path
 func NewEmulation(code string) (*Emulation, error) {
-	c, err := extractClient(code)
+	return LoadEmulation(code, "")
+}
+
+// LoadEmulation builds the emulation of a client code, searching profilesDir before the embedded
+// profiles, or of a JSON profile path
+func LoadEmulation(code, profilesDir string) (*Emulation, error) {
+	c, origin, err := extractClient(code, profilesDir)
 	if err != nil {
 		return nil, err
 	}
+	if err := c.Validate(); err != nil {
+		if origin == code {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: %w", origin, err)
+	}
 
-	peerG, err := generator2.NewRegexPeerIdGenerator(c.PeerID.Regex)
+	peerG, err := generator2.NewPeerId(c.PeerID)
 	if err != nil {
 		return nil, err
 	}
 
-	keyG, err := generator2.NewDefaultKeyGenerator()
+	keyG, err := generator2.NewKey(c.Key)
 	if err != nil {
 		return nil, err
 	}
 
-	roudingG, err := generator2.NewDefaultRoudingGenerator()
+	roudingG, err := generator2.NewRounding(c.Rounding)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Emulation{PeerIdGenerator: peerG, KeyGenerator: keyG, RoundingGenerator: roudingG,
-		Headers: c.Headers, Name: c.Name, Query: c.Query}, nil
+		Headers: c.Headers, Name: c.Name, Query: c.Query, Origin: origin, Events: c.Events,
+		peerIdConfig: c.PeerID, keyConfig: c.Key}, nil
 
 }
 
+// LoadClientInfo reads the profile of a client code or JSON profile path, searching profilesDir before the
+// embedded profiles, without building its generators
+func LoadClientInfo(code, profilesDir string) (*ClientInfo, error) {
+	c, _, err := extractClient(code, profilesDir)
+	return c, err
+}
+
 //go:embed static
 var staticFiles embed.FS
 
-func extractClient(code string) (*ClientInfo, error) {
-
-	f, err := staticFiles.Open("static/" + code + ".json")
+func extractClient(code, profilesDir string) (*ClientInfo, string, error) {
+	bytes, origin, err := readProfile(code, profilesDir)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	defer f.Close()
 
-	bytes, err := io.ReadAll(f)
-	if err != nil {
-		return nil, err
+	var client ClientInfo
+
+	if err := json.Unmarshal(bytes, &client); err != nil {
+		return nil, "", fmt.Errorf("invalid profile %s: %w", origin, err)
 	}
 
-	var client ClientInfo
+	return &client, origin, nil
+}
 
-	json.Unmarshal(bytes, &client)
+// readProfile returns the profile content and where it was found
+func readProfile(code, profilesDir string) ([]byte, string, error) {
+	if IsProfilePath(code) {
+		bytes, err := os.ReadFile(code)
+		return bytes, code, err
+	}
 
-	return &client, nil
+	if profilesDir != "" {
+		path := filepath.Join(profilesDir, code+".json")
+		bytes, err := os.ReadFile(path)
+		if err == nil {
+			return bytes, path, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, "", err
+		}
+	}
+
+	bytes, err := staticFiles.ReadFile("static/" + code + ".json")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", fmt.Errorf("unknown client %q, run the clients command to list them", code)
+	}
+	return bytes, EmbeddedOrigin, err
 }
@@ -1,8 +1,17 @@
 package emulation
 
 import (
+	"flag"
+	"fmt"
 	"io/fs"
+	"os"
+	"path/filepath"
+	generator2 "ratio-spoof/generator"
+	"reflect"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -10,7 +19,7 @@ func TestNewEmulation(t *testing.T) {
 	var counter int
 	fs.WalkDir(staticFiles, ".", func(path string, d fs.DirEntry, err error) error {
 		if counter > 1 {
-			code := strings.TrimRight(strings.TrimLeft(path, "static/"), ".json")
+			code := strings.TrimSuffix(strings.TrimPrefix(path, "static/"), ".json")
 			e, err := NewEmulation(code)
 			if err != nil {
 				t.Error("should not return error ")
@@ -40,9 +49,9 @@ func TestExtractClient(t *testing.T) {
 	var counter int
 	fs.WalkDir(staticFiles, ".", func(path string, d fs.DirEntry, err error) error {
 		if counter > 1 {
-			code := strings.TrimRight(strings.TrimLeft(path, "static/"), ".json")
-			c, e := extractClient(code)
-			if e != nil || err != nil {
+			code := strings.TrimSuffix(strings.TrimPrefix(path, "static/"), ".json")
+			c, origin, e := extractClient(code, "")
+			if e != nil || err != nil || origin != EmbeddedOrigin {
 				t.Error("should not return error")
 			}
 
@@ -72,3 +81,577 @@ func TestExtractClient(t *testing.T) {
 	})
 
 }
+
+func TestLoadEmulation(t *testing.T) {
+	dir := t.TempDir()
+	profile, _ := staticFiles.ReadFile("static/qbit-5.0.4.json")
+	custom := strings.ReplaceAll(string(profile), "5.0.4", "9.9.9")
+	os.WriteFile(filepath.Join(dir, "qbit-9.9.9.json"), []byte(custom), 0o600)
+	os.WriteFile(filepath.Join(dir, "qbit-4.6.5.json"), []byte(custom), 0o600)
+
+	data := []struct {
+		code   string
+		name   string
+		origin string
+	}{
+		{"qbit-9.9.9", "qBittorrent v9.9.9", filepath.Join(dir, "qbit-9.9.9.json")},
+		{"qbit-4.6.5", "qBittorrent v9.9.9", filepath.Join(dir, "qbit-4.6.5.json")},
+		{"qbit-4.3.9", "qBittorrent v4.3.9", EmbeddedOrigin},
+		{filepath.Join(dir, "qbit-9.9.9.json"), "qBittorrent v9.9.9", filepath.Join(dir, "qbit-9.9.9.json")},
+	}
+	for _, td := range data {
+		e, err := LoadEmulation(td.code, dir)
+		if err != nil {
+			t.Fatalf("should not return error: %v", err)
+		}
+		if e.Name != td.name || e.Origin != td.origin {
+			t.Errorf("%s: got %v from %v want %v from %v", td.code, e.Name, e.Origin, td.name, td.origin)
+		}
+	}
+
+	if _, err := LoadEmulation("qbit-0.0.1", dir); err == nil || err.Error() != `unknown client "qbit-0.0.1", run the clients command to list them` {
+		t.Errorf("got: %v", err)
+	}
+}
+
+func TestListProfiles(t *testing.T) {
+	dir := t.TempDir()
+	profile, _ := staticFiles.ReadFile("static/qbit-5.0.4.json")
+	os.WriteFile(filepath.Join(dir, "qbit-5.0.4.json"), profile, 0o600)
+	os.WriteFile(filepath.Join(dir, "custom.json"), profile, 0o600)
+
+	profiles, err := ListProfiles(dir)
+	if err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+	got := make(map[string]Profile)
+	for _, p := range profiles {
+		got[p.Code] = p
+	}
+	if p := got["custom"]; p.Origin != filepath.Join(dir, "custom.json") || p.Overrides || p.Name != "qBittorrent v5.0.4" {
+		t.Errorf("got: %+v", p)
+	}
+	if p := got["qbit-5.0.4"]; p.Origin != filepath.Join(dir, "qbit-5.0.4.json") || !p.Overrides {
+		t.Errorf("got: %+v", p)
+	}
+	if p := got["qbit-4.0.3"]; p.Origin != EmbeddedOrigin || p.Overrides {
+		t.Errorf("got: %+v", p)
+	}
+	if profiles[0].Code != "custom" {
+		t.Errorf("profiles should be sorted by code, got %v first", profiles[0].Code)
+	}
+
+	embedded, _ := ListProfiles(filepath.Join(dir, "missing"))
+	if len(embedded) != len(profiles)-1 {
+		t.Errorf("got %v profiles want %v", len(embedded), len(profiles)-1)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *ClientInfo {
+		c, _, _ := extractClient("qbit-5.0.4", "")
+		return c
+	}
+	data := []struct {
+		name   string
+		change func(c *ClientInfo)
+		want   []string
+	}{
+		{name: "valid profile", change: func(c *ClientInfo) {}},
+		{
+			name:   "missing fields",
+			change: func(c *ClientInfo) { c.Name = ""; c.Key.Generator = ""; c.Rounding.Generator = ""; c.Headers = nil },
+			want:   []string{"name is required", "key generator or regex is required", "rounding generator is required", "User-Agent header is required"},
+		},
+		{
+			name:   "broken peer id regex",
+			change: func(c *ClientInfo) { c.PeerID.Regex = "-qB5040-[A-Z" },
+			want:   []string{"peer id regex does not compile: error parsing regexp: missing closing ]: `[A-Z`"},
+		},
+		{
+			name:   "peer id regex generating less than 20 bytes",
+			change: func(c *ClientInfo) { c.PeerID.Regex = "-qB5040-[A-Z]{11}" },
+			want:   []string{"is 19 bytes instead of 20"},
+		},
+		{
+			name:   "peer id regex generating a variable length",
+			change: func(c *ClientInfo) { c.PeerID.Regex = "-qB5040-[A-Z]{10,12}" },
+			want:   []string{"bytes instead of 20"},
+		},
+		{
+			name: "unknown generators",
+			change: func(c *ClientInfo) {
+				c.Key.Generator = "uuidKeyGenerator"
+				c.Rounding.Generator = "ceilRoundingGenerator"
+				c.PeerID.Generator = "azureusPeerIdGenerator"
+			},
+			want: []string{`unknown key generator "uuidKeyGenerator"`, `unknown rounding generator "ceilRoundingGenerator"`, `unknown peer id generator "azureusPeerIdGenerator"`},
+		},
+		{
+			name: "invalid rounding parameters",
+			change: func(c *ClientInfo) {
+				c.Rounding.Downloaded = "chunk"
+			},
+			want: []string{`downloaded rounding must be "none", "block" or "piece", got "chunk"`},
+		},
+		{
+			name: "unknown lifecycle",
+			change: func(c *ClientInfo) {
+				c.PeerID.Lifecycle = "session"
+			},
+			want: []string{`peer id lifecycle must be one of [process torrent stopped], got "session"`},
+		},
+		{
+			name:   "empty query",
+			change: func(c *ClientInfo) { c.Query = "" },
+			want:   []string{"query is required"},
+		},
+		{
+			name:   "unknown and missing placeholders",
+			change: func(c *ClientInfo) { c.Query = strings.Replace(c.Query, "{uploaded}", "{uplaoded}", 1) },
+			want:   []string{"unknown placeholder {uplaoded}", "query is missing the {uploaded} placeholder"},
+		},
+		{
+			name:   "optional placeholders",
+			change: func(c *ClientInfo) { c.Query = strings.Replace(c.Query, "{key}", "{key?}", 1) },
+		},
+		{
+			name:   "unknown optional placeholder",
+			change: func(c *ClientInfo) { c.Query += "&ip={address?}" },
+			want:   []string{"unknown placeholder {address?}"},
+		},
+		{
+			name: "invalid event overrides",
+			change: func(c *ClientInfo) {
+				numWant := -1
+				c.Events = map[string]EventOverride{"stopped": {NumWant: &numWant}, "paused": {}}
+			},
+			want: []string{"stopped numwant can not be negative", `unknown event "paused"`},
+		},
+	}
+	for _, td := range data {
+		t.Run(td.name, func(t *testing.T) {
+			c := valid()
+			td.change(c)
+			err := c.Validate()
+			if td.want == nil {
+				if err != nil {
+					t.Errorf("should not return error: %v", err)
+				}
+				return
+			}
+			validationErr, ok := err.(*ValidationError)
+			if !ok || len(validationErr.Problems) != len(td.want) {
+				t.Fatalf("got: %v want %v", err, td.want)
+			}
+			for idx, want := range td.want {
+				if !strings.Contains(validationErr.Problems[idx], want) {
+					t.Errorf("got: %v want %v", validationErr.Problems[idx], want)
+				}
+			}
+		})
+	}
+}
+
+func TestEmbeddedProfilesAreValid(t *testing.T) {
+	entries, _ := staticFiles.ReadDir("static")
+	for _, entry := range entries {
+		c, _, err := extractClient(strings.TrimSuffix(entry.Name(), ".json"), "")
+		if err != nil {
+			t.Fatalf("%s should not return error: %v", entry.Name(), err)
+		}
+		if err := c.Validate(); err != nil {
+			t.Errorf("%s: %v", entry.Name(), err)
+		}
+	}
+}
+
+func TestExtractClientInvalidJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.json")
+	os.WriteFile(path, []byte(`{"name": 1}`), 0o600)
+	if _, _, err := extractClient(path, ""); err == nil || !strings.HasPrefix(err.Error(), "invalid profile "+path) {
+		t.Errorf("got: %v", err)
+	}
+}
+
+// update rewrites the golden files, run go test ./emulation -update after changing a profile and review the diff
+var update = flag.Bool("update", false, "rewrite the golden announce urls of the embedded profiles")
+
+// TestBuildQuery compares the announce urls of every embedded profile with testdata/<code>.golden, one
+// line for each event followed by the headers. The peer id and key come from seeded generators so the
+// golden files pin their format too
+func TestBuildQuery(t *testing.T) {
+	values := AnnounceValues{
+		InfoHash: "%b1h%0aU%cf%c8i%3cl%02%des-%d1%7c3%e2Q%e8%e5",
+		Port:     8999,
+		NumWant:  200,
+	}
+	events := []string{"started", "", "completed", "stopped"}
+	defer generator2.Unseed()
+
+	entries, _ := staticFiles.ReadDir("static")
+	for _, entry := range entries {
+		code := strings.TrimSuffix(entry.Name(), ".json")
+		t.Run(code, func(t *testing.T) {
+			generator2.Seed(1)
+			e, err := NewEmulation(code)
+			if err != nil {
+				t.Fatalf("should not return error: %v", err)
+			}
+			// amounts between blocks and pieces pin the rounding of each profile
+			v := values
+			v.PeerId, v.Key = e.PeerId(), e.Key()
+			v.Downloaded, v.Uploaded, v.Left = e.Round(100000, 70000, 250000, 65536)
+			var got strings.Builder
+			for _, event := range events {
+				v.Event = event
+				fmt.Fprintf(&got, "http://tracker.example.org/announce?%s\n", e.BuildQuery(v))
+			}
+			headers := make([]string, 0, len(e.Headers))
+			for name, value := range e.Headers {
+				headers = append(headers, name+": "+value)
+			}
+			sort.Strings(headers)
+			fmt.Fprintf(&got, "%s\n", strings.Join(headers, "\n"))
+
+			golden := filepath.Join("testdata", code+".golden")
+			if *update {
+				if err := os.WriteFile(golden, []byte(got.String()), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%s has no expected urls, run with -update to create them: %v", code, err)
+			}
+			if got.String() != string(want) {
+				t.Errorf("got:\n%v\nwant:\n%v", got.String(), string(want))
+			}
+		})
+	}
+}
+
+func TestProfileIdentities(t *testing.T) {
+	upperHexKey := regexp.MustCompile(`^[0-9A-F]{8}$`)
+	data := map[string]struct {
+		peerIdPrefix string
+		key          *regexp.Regexp
+	}{
+		"qbit-4.0.3":         {"-qB4030-", upperHexKey},
+		"qbit-4.3.9":         {"-qB4390-", upperHexKey},
+		"qbit-4.6.5":         {"-qB4650-", upperHexKey},
+		"qbit-5.0.4":         {"-qB5040-", upperHexKey},
+		"qbit-5.1.0":         {"-qB5100-", upperHexKey},
+		"deluge-2.1.1":       {"-DE211s-", upperHexKey},
+		"transmission-4.0.6": {"-TR4060-", upperHexKey},
+		"rtorrent-0.9.8":     {"-lt0D80-", regexp.MustCompile(`^[0-9a-f]{8}$`)},
+	}
+
+	entries, _ := staticFiles.ReadDir("static")
+	for _, entry := range entries {
+		code := strings.TrimSuffix(entry.Name(), ".json")
+		t.Run(code, func(t *testing.T) {
+			want, ok := data[code]
+			if !ok {
+				t.Fatalf("%s has no expected peer id and key", code)
+			}
+			e, err := NewEmulation(code)
+			if err != nil {
+				t.Fatalf("should not return error: %v", err)
+			}
+			if peerId := e.PeerId(); len(peerId) != 20 || !strings.HasPrefix(peerId, want.peerIdPrefix) {
+				t.Errorf("got peer id %q want 20 bytes starting with %q", peerId, want.peerIdPrefix)
+			}
+			if key := e.Key(); !want.key.MatchString(key) {
+				t.Errorf("got key %q want %v", key, want.key)
+			}
+		})
+	}
+}
+
+func TestEscapeQueryValue(t *testing.T) {
+	data := []struct {
+		in   string
+		want string
+	}{
+		{"-qB5040-AZaz09_.~!*()", "-qB5040-AZaz09_.~!*()"},
+		{"a&b=c", "a%26b%3dc"},
+		{"1 2+3", "1%202%2b3"},
+		{"\xff\x00", "%ff%00"},
+		{"2001:db8::1", "2001%3adb8%3a%3a1"},
+	}
+	for _, td := range data {
+		if got := escapeQueryValue(td.in); got != td.want {
+			t.Errorf("got %v want %v", got, td.want)
+		}
+	}
+}
+
+func TestBuildQueryOptionalParams(t *testing.T) {
+	numWant := 0
+	e := &Emulation{
+		Query:  "info_hash={infohash}&key={key?}&event={event?}&numwant={numwant}&compact=1&ipv4={ipv4?}&ipv6={ipv6?}",
+		Events: map[string]EventOverride{"stopped": {NumWant: &numWant}},
+	}
+	data := []struct {
+		values AnnounceValues
+		want   string
+	}{
+		{AnnounceValues{InfoHash: "%aa", Key: "k", Event: "started", NumWant: 200}, "info_hash=%aa&key=k&event=started&numwant=200&compact=1"},
+		{AnnounceValues{InfoHash: "%aa", Key: "k", NumWant: 200}, "info_hash=%aa&key=k&numwant=200&compact=1"},
+		{AnnounceValues{InfoHash: "%aa", NumWant: 200}, "info_hash=%aa&numwant=200&compact=1"},
+		{AnnounceValues{InfoHash: "%aa", Key: "k", Event: "stopped", NumWant: 200}, "info_hash=%aa&key=k&event=stopped&numwant=0&compact=1"},
+		{AnnounceValues{InfoHash: "%aa", NumWant: 200, IPv4: "203.0.113.7", IPv6: "2001:db8::1"}, "info_hash=%aa&numwant=200&compact=1&ipv4=203.0.113.7&ipv6=2001%3adb8%3a%3a1"},
+	}
+	for _, td := range data {
+		if got := e.BuildQuery(td.values); got != td.want {
+			t.Errorf("got %v want %v", got, td.want)
+		}
+	}
+}
+
+func TestApplyEvent(t *testing.T) {
+	numWant := 50
+	data := []struct {
+		name   string
+		events map[string]EventOverride
+		event  string
+		want   int
+	}{
+		{name: "no override", event: "started", want: 200},
+		{name: "stopped without override", event: "stopped", want: 0},
+		{name: "stopped override", events: map[string]EventOverride{"stopped": {NumWant: &numWant}}, event: "stopped", want: 50},
+		{name: "stopped override without numwant", events: map[string]EventOverride{"stopped": {}}, event: "stopped", want: 0},
+		{name: "completed override", events: map[string]EventOverride{"completed": {NumWant: &numWant}}, event: "completed", want: 50},
+	}
+	for _, td := range data {
+		t.Run(td.name, func(t *testing.T) {
+			e := &Emulation{Events: td.events}
+			if got := e.ApplyEvent(AnnounceValues{Event: td.event, NumWant: 200}); got.NumWant != td.want {
+				t.Errorf("got numwant %v want %v", got.NumWant, td.want)
+			}
+		})
+	}
+}
+
+func TestIdentities(t *testing.T) {
+	rtorrent, _ := NewEmulation("rtorrent-0.9.8")
+	transmission, _ := NewEmulation("transmission-4.0.6")
+	path := filepath.Join(t.TempDir(), "identities.json")
+	ids, err := LoadIdentities(path)
+	if err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+
+	first, second := ids.Get(rtorrent, "aa"), ids.Get(rtorrent, "bb")
+	if first.PeerId != second.PeerId || first.Key == second.Key {
+		t.Errorf("process peer ids should be shared and torrent keys not, got %+v %+v", first, second)
+	}
+	if again := ids.Get(rtorrent, "aa"); again != first {
+		t.Errorf("got %+v want the same identity %+v", again, first)
+	}
+
+	started := ids.Get(transmission, "aa")
+	if started.PeerId == first.PeerId || !strings.HasPrefix(started.PeerId, "-TR4060-") {
+		t.Errorf("each client should have its own identity, got %+v", started)
+	}
+	ids.Stopped(rtorrent, "aa")
+	ids.Stopped(transmission, "aa")
+	restarted := ids.Get(transmission, "aa")
+	if restarted.PeerId == started.PeerId || restarted.Key != started.Key {
+		t.Errorf("only the peer id should be generated again after stopped, got %+v then %+v", started, restarted)
+	}
+	if again := ids.Get(rtorrent, "aa"); again != first {
+		t.Errorf("got %+v want %+v", again, first)
+	}
+
+	if err := ids.Save(); err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+	resumed, err := LoadIdentities(path)
+	if err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+	if got := resumed.Get(rtorrent, "bb"); got != second {
+		t.Errorf("got %+v want the saved identity %+v", got, second)
+	}
+	if got := resumed.Get(transmission, "aa"); got != restarted {
+		t.Errorf("got %+v want the saved identity %+v", got, restarted)
+	}
+
+	var none *Identities
+	if got := none.Get(rtorrent, "aa"); got.PeerId != rtorrent.PeerId() || got.Key != rtorrent.Key() {
+		t.Errorf("nil identities should use the emulation values, got %+v", got)
+	}
+}
+
+func TestIdentitiesConcurrentSave(t *testing.T) {
+	rtorrent, _ := NewEmulation("rtorrent-0.9.8")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "identities.json")
+	ids, _ := LoadIdentities(path)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(infoHash string) {
+			defer wg.Done()
+			ids.Get(rtorrent, infoHash)
+			errs <- ids.Save()
+		}(fmt.Sprint(i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("should not return error: %v", err)
+		}
+	}
+
+	resumed, err := LoadIdentities(path)
+	if err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+	for i := 0; i < 8; i++ {
+		if got, want := resumed.Get(rtorrent, fmt.Sprint(i)), ids.Get(rtorrent, fmt.Sprint(i)); got != want {
+			t.Errorf("torrent %v: got %+v want the saved identity %+v", i, got, want)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("got %v files want only the identities file", len(entries))
+	}
+}
+
+func TestLoadIdentitiesInvalidJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identities.json")
+	os.WriteFile(path, []byte("{"), 0o600)
+	if _, err := LoadIdentities(path); err == nil || !strings.HasPrefix(err.Error(), "invalid identities file") {
+		t.Errorf("got: %v", err)
+	}
+}
+
+func TestCaptureProfile(t *testing.T) {
+	e, _ := NewEmulation("qbit-5.0.4")
+	query := e.BuildQuery(AnnounceValues{InfoHash: "%b1h%0aU", PeerId: "-qB5040-a~b(c)d!e.f*", Key: "0A1B2C3D", Port: 8999, Left: 4096, Event: "started", NumWant: 200})
+	raw := "GET /announce?" + query + " HTTP/1.1\nHost: tracker.example.org\nUser-Agent: qBittorrent/5.0.4\nAccept-Encoding: gzip\nConnection: close\n"
+	har := `{"log": {"entries": [
+		{"request": {"url": "https://tracker.example.org/favicon.ico", "headers": []}},
+		{"request": {"url": "https://tracker.example.org/announce?` + query + `", "headers": [
+			{"name": ":authority", "value": "tracker.example.org"},
+			{"name": "user-agent", "value": "qBittorrent/5.0.4"},
+			{"name": "accept-encoding", "value": "gzip"}
+		]}}
+	]}}`
+
+	for name, capture := range map[string]string{"raw request": raw, "HAR file": har} {
+		t.Run(name, func(t *testing.T) {
+			c, err := ParseCapture([]byte(capture))
+			if err != nil {
+				t.Fatalf("should not return error: %v", err)
+			}
+			profile, warnings := c.Profile()
+			if len(warnings) > 0 {
+				t.Errorf("got warnings %v", warnings)
+			}
+			if err := profile.Validate(); err != nil {
+				t.Errorf("should not return error: %v", err)
+			}
+			want := &ClientInfo{
+				Name:     "qBittorrent/5.0.4",
+				PeerID:   generator2.Config{Regex: "-qB5040-[A-Za-z0-9_~\\(\\)\\!\\.\\*-]{12}"},
+				Key:      generator2.Config{Generator: generator2.HexKey, Length: 8},
+				Rounding: generator2.Config{Generator: generator2.DefaultRounding},
+				Query:    e.Query,
+				Headers:  map[string]string{"User-Agent": "qBittorrent/5.0.4", "Accept-Encoding": "gzip"},
+			}
+			if !reflect.DeepEqual(profile, want) {
+				t.Errorf("got:  %+v\nwant: %+v", profile, want)
+			}
+		})
+	}
+
+	t.Run("Guessed generators", func(t *testing.T) {
+		data := []struct {
+			peerId, key string
+			wantPeerId  string
+			wantKey     generator2.Config
+		}{
+			{"-TR4060-k2j4h5g6f7d8", "3F2A9C1B", "-TR4060-[0-9a-z]{12}", generator2.Config{Generator: generator2.HexKey, Length: 8}},
+			{"-lt0D80-AbCdEfGh1234", "0a1b2c3d", "-lt0D80-[A-Za-z0-9]{12}", generator2.Config{Generator: generator2.RegexKey, Regex: "[0-9a-f]{8}"}},
+			{"M7-2-2--abcdefghijkl", "x_y", "[A-Za-z0-9_~\\(\\)\\!\\.\\*-]{20}", generator2.Config{Generator: generator2.RegexKey, Regex: "[A-Za-z0-9_~\\(\\)\\!\\.\\*-]{3}"}},
+		}
+		for _, td := range data {
+			c, _ := ParseCapture([]byte("GET /announce?info_hash=%aa&peer_id=" + td.peerId + "&key=" + td.key + "&port=1&uploaded=0&downloaded=0&left=0&event=started HTTP/1.1\nUser-Agent: x\n"))
+			profile, _ := c.Profile()
+			if profile.PeerID.Regex != td.wantPeerId || profile.Key != td.wantKey {
+				t.Errorf("got %v %+v want %v %+v", profile.PeerID.Regex, profile.Key, td.wantPeerId, td.wantKey)
+			}
+		}
+	})
+
+	t.Run("Missing event and key", func(t *testing.T) {
+		c, _ := ParseCapture([]byte("GET /announce?info_hash=%aa&peer_id=-TR4060-k2j4h5g6f7d8&port=1&uploaded=0&downloaded=0&left=0 HTTP/1.1\nUser-Agent: x\n"))
+		profile, warnings := c.Profile()
+		if len(warnings) != 2 || profile.Key.Generator != generator2.DefaultKey {
+			t.Errorf("got warnings %v key %+v", warnings, profile.Key)
+		}
+	})
+
+	t.Run("Invalid captures", func(t *testing.T) {
+		data := []struct {
+			capture string
+			want    string
+		}{
+			{"not a request", "invalid http request"},
+			{"{", "invalid HAR file"},
+			{`{"log": {"entries": [{"request": {"url": "https://tracker.example.org/"}}]}}`, "HAR file has no announce request"},
+		}
+		for _, td := range data {
+			if _, err := ParseCapture([]byte(td.capture)); err == nil || !strings.HasPrefix(err.Error(), td.want) {
+				t.Errorf("got: %v want %v", err, td.want)
+			}
+		}
+	})
+}
+
+func TestDiff(t *testing.T) {
+	a, _ := LoadClientInfo("qbit-5.0.4", "")
+	if got := Diff(a, a); len(got) != 0 {
+		t.Errorf("got %v want no difference", got)
+	}
+
+	b, _ := LoadClientInfo("qbit-5.0.4", "")
+	b.Headers = map[string]string{"User-Agent": "qBittorrent/5.0.4", "Accept": "*/*"}
+	b.Events = nil
+	b.Key.Length = 10
+	got := Diff(a, b)
+	want := []Difference{
+		{Field: "key", A: `{"generator":"defaultKeyGenerator"}`, B: `{"generator":"defaultKeyGenerator","length":10}`},
+		{Field: "events", A: `{"stopped":{"numwant":0}}`, B: MissingValue},
+		{Field: "header Accept", A: MissingValue, B: "*/*"},
+		{Field: "header Accept-Encoding", A: "gzip", B: MissingValue},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:  %v\nwant: %v", got, want)
+	}
+
+	b, _ = LoadClientInfo("qbit-5.0.4", "")
+	b.Query = "a=1&b={port}"
+	a.Query = "b={port}&a=1"
+	got = Diff(a, b)
+	want = []Difference{{Field: "query order", A: "b&a", B: "a&b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:  %v\nwant: %v", got, want)
+	}
+	b.Query = "a=2&c=3"
+	got = Diff(a, b)
+	want = []Difference{
+		{Field: "query a", A: "1", B: "2"},
+		{Field: "query b", A: "{port}", B: MissingValue},
+		{Field: "query c", A: MissingValue, B: "3"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:  %v\nwant: %v", got, want)
+	}
+}
@@ -0,0 +1,161 @@
+package emulation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	generator2 "ratio-spoof/generator"
+	"sync"
+)
+
+// processScope holds the values shared by every torrent, info hashes are the other scopes
+const processScope = "process"
+
+// Identity is the peer id and key a torrent is announced with
+type Identity struct {
+	PeerId string `json:"peerId,omitempty"`
+	Key    string `json:"key,omitempty"`
+}
+
+// Identities hands out the peer ids and keys following the lifecycle declared by each profile. One is
+// shared by the sessions of a process and can be saved to a file so restarted sessions resume with the
+// same values
+type Identities struct {
+	mu   sync.Mutex
+	path string
+	// clients holds the identities by client name, then by info hash or processScope
+	clients map[string]map[string]Identity
+}
+
+// NewIdentities keeps the identities in memory only
+func NewIdentities() *Identities {
+	return &Identities{clients: make(map[string]map[string]Identity)}
+}
+
+// LoadIdentities reads the identities saved to path, Save writes them back there. A missing file starts
+// with no identity
+func LoadIdentities(path string) (*Identities, error) {
+	ids := NewIdentities()
+	ids.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ids, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &ids.clients); err != nil {
+		return nil, fmt.Errorf("invalid identities file %s: %w", path, err)
+	}
+	if ids.clients == nil {
+		ids.clients = make(map[string]map[string]Identity)
+	}
+	return ids, nil
+}
+
+// Get returns the identity of the torrent for the emulated client, generating the missing values. Nil
+// identities return the values generated with the emulation
+func (ids *Identities) Get(e *Emulation, infoHash string) Identity {
+	if ids == nil {
+		return Identity{PeerId: e.PeerId(), Key: e.Key()}
+	}
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+	return Identity{
+		PeerId: ids.value(e.Name, lifecycleScope(e.peerIdConfig, infoHash), func(i *Identity) *string { return &i.PeerId }, e.generatePeerId),
+		Key:    ids.value(e.Name, lifecycleScope(e.keyConfig, infoHash), func(i *Identity) *string { return &i.Key }, e.generateKey),
+	}
+}
+
+// Stopped forgets the values of the torrent that are generated again after a stopped announce
+func (ids *Identities) Stopped(e *Emulation, infoHash string) {
+	if ids == nil {
+		return
+	}
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+	id, ok := ids.clients[e.Name][infoHash]
+	if !ok {
+		return
+	}
+	if e.peerIdConfig.Lifecycle == generator2.LifecycleStopped {
+		id.PeerId = ""
+	}
+	if e.keyConfig.Lifecycle == generator2.LifecycleStopped {
+		id.Key = ""
+	}
+	ids.clients[e.Name][infoHash] = id
+}
+
+// Save writes the identities to the file they were loaded from, it does nothing for in memory ones. The lock
+// is held until the file is replaced so an older snapshot never overwrites a newer one
+func (ids *Identities) Save() error {
+	if ids == nil || ids.path == "" {
+		return nil
+	}
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+	data, err := json.MarshalIndent(ids.clients, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(ids.path), filepath.Base(ids.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), ids.path)
+}
+
+func (ids *Identities) value(client, scope string, field func(*Identity) *string, generate func() string) string {
+	scopes, ok := ids.clients[client]
+	if !ok {
+		scopes = make(map[string]Identity)
+		ids.clients[client] = scopes
+	}
+	id := scopes[scope]
+	if *field(&id) == "" {
+		*field(&id) = generate()
+		scopes[scope] = id
+	}
+	return *field(&id)
+}
+
+func lifecycleScope(cfg generator2.Config, infoHash string) string {
+	if cfg.Lifecycle == generator2.LifecycleProcess {
+		return processScope
+	}
+	return infoHash
+}
+
+// generatePeerId returns a new peer id, or the one generated with the emulation for emulations built
+// without profile
+func (e *Emulation) generatePeerId() string {
+	if e.peerIdConfig != (generator2.Config{}) {
+		if g, err := generator2.NewPeerId(e.peerIdConfig); err == nil {
+			return g.PeerId()
+		}
+	}
+	return e.PeerId()
+}
+
+// generateKey returns a new key, or the one generated with the emulation for emulations built without
+// profile
+func (e *Emulation) generateKey() string {
+	if e.keyConfig != (generator2.Config{}) {
+		if g, err := generator2.NewKey(e.keyConfig); err == nil {
+			return g.Key()
+		}
+	}
+	return e.Key()
+}
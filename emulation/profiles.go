@@ -0,0 +1,90 @@
+package emulation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// EmbeddedOrigin is the origin of the profiles compiled in the binary
+const EmbeddedOrigin = "embedded"
+
+// Profile describes an emulation profile that can be given as client code
+type Profile struct {
+	Code string
+	Name string
+	// Origin is EmbeddedOrigin or the path of the profile file
+	Origin string
+	// Overrides tells the profile file takes the place of an embedded profile with the same code
+	Overrides bool
+	// Err is set when the profile file can not be read
+	Err error
+}
+
+// IsProfilePath tells if the client code is the path of a JSON profile instead of a code
+func IsProfilePath(code string) bool {
+	return strings.HasSuffix(strings.ToLower(code), ".json") || strings.ContainsRune(code, '/') || strings.ContainsRune(code, filepath.Separator)
+}
+
+// DefaultProfilesDir is the profiles directory used when none is given, it may not exist
+func DefaultProfilesDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ratio-spoof", "profiles")
+}
+
+// ListProfiles returns the embedded profiles and the ones of profilesDir sorted by code, a missing
+// directory only lists the embedded profiles
+func ListProfiles(profilesDir string) ([]Profile, error) {
+	byCode := make(map[string]Profile)
+	entries, err := staticFiles.ReadDir("static")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		code := strings.TrimSuffix(entry.Name(), ".json")
+		bytes, _ := staticFiles.ReadFile("static/" + entry.Name())
+		byCode[code] = newProfile(code, EmbeddedOrigin, bytes, nil)
+	}
+
+	if profilesDir != "" {
+		paths, err := filepath.Glob(filepath.Join(profilesDir, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			code := strings.TrimSuffix(filepath.Base(path), ".json")
+			bytes, err := os.ReadFile(path)
+			_, embedded := byCode[code]
+			profile := newProfile(code, path, bytes, err)
+			profile.Overrides = embedded && byCode[code].Origin == EmbeddedOrigin
+			byCode[code] = profile
+		}
+	}
+
+	profiles := make([]Profile, 0, len(byCode))
+	for _, profile := range byCode {
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Code < profiles[j].Code })
+	return profiles, nil
+}
+
+func newProfile(code, origin string, bytes []byte, err error) Profile {
+	profile := Profile{Code: code, Origin: origin, Err: err}
+	if err == nil {
+		var client ClientInfo
+		if err := json.Unmarshal(bytes, &client); err != nil {
+			profile.Err = fmt.Errorf("invalid profile: %w", err)
+			return profile
+		}
+		profile.Name = client.Name
+		profile.Err = client.Validate()
+	}
+	return profile
+}
@@ -0,0 +1,105 @@
+package emulation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// unreservedQueryChars are sent as they are, as libtorrent does, every other byte is percent-encoded
+const unreservedQueryChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_.!~*()"
+
+// optionalSuffix marks a placeholder whose whole parameter is dropped when its value is empty,
+// event={event?} is only sent on started, completed and stopped announces
+const optionalSuffix = "?"
+
+// preEncodedPlaceholders hold values already percent-encoded, the info hash is encoded from its raw bytes
+var preEncodedPlaceholders = map[string]bool{"infohash": true}
+
+// EventOverride replaces announce values on the announces sending an event
+type EventOverride struct {
+	NumWant *int `json:"numwant,omitempty"`
+}
+
+// ApplyEvent returns the values with the profile overrides of their event applied, a stopped announce
+// asks for no peers unless the profile overrides its numwant
+func (e *Emulation) ApplyEvent(v AnnounceValues) AnnounceValues {
+	override := e.Events[v.Event]
+	switch {
+	case override.NumWant != nil:
+		v.NumWant = *override.NumWant
+	case v.Event == "stopped":
+		v.NumWant = 0
+	}
+	return v
+}
+
+// BuildQuery fills the client query template with the announce values and the overrides of their event,
+// parameters with an empty optional placeholder are dropped and every value but the pre-encoded ones is
+// percent-encoded so it can not break the query
+func (e *Emulation) BuildQuery(v AnnounceValues) string {
+	v = e.ApplyEvent(v)
+	values := map[string]string{
+		"infohash":   v.InfoHash,
+		"port":       fmt.Sprint(v.Port),
+		"peerid":     v.PeerId,
+		"uploaded":   fmt.Sprint(v.Uploaded),
+		"downloaded": fmt.Sprint(v.Downloaded),
+		"left":       fmt.Sprint(v.Left),
+		"key":        v.Key,
+		"event":      v.Event,
+		"numwant":    fmt.Sprint(v.NumWant),
+		"ip":         v.IP,
+		"ipv4":       v.IPv4,
+		"ipv6":       v.IPv6,
+	}
+
+	var params []string
+	for _, param := range strings.Split(e.Query, "&") {
+		if dropParam(param, values) {
+			continue
+		}
+		params = append(params, placeholderRegex.ReplaceAllStringFunc(param, func(placeholder string) string {
+			name, _ := placeholderName(placeholder)
+			value, ok := values[name]
+			if !ok {
+				return placeholder
+			}
+			if preEncodedPlaceholders[name] {
+				return value
+			}
+			return escapeQueryValue(value)
+		}))
+	}
+	return strings.Join(params, "&")
+}
+
+// dropParam tells if the parameter has an optional placeholder without value
+func dropParam(param string, values map[string]string) bool {
+	for _, placeholder := range placeholderRegex.FindAllString(param, -1) {
+		if name, optional := placeholderName(placeholder); optional && values[name] == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// placeholderName returns the name inside the braces and if it is optional
+func placeholderName(placeholder string) (name string, optional bool) {
+	name = placeholder[1 : len(placeholder)-1]
+	if strings.HasSuffix(name, optionalSuffix) {
+		return strings.TrimSuffix(name, optionalSuffix), true
+	}
+	return name, false
+}
+
+func escapeQueryValue(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if strings.IndexByte(unreservedQueryChars, value[i]) >= 0 {
+			b.WriteByte(value[i])
+		} else {
+			fmt.Fprintf(&b, "%%%02x", value[i])
+		}
+	}
+	return b.String()
+}
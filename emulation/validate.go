@@ -0,0 +1,150 @@
+package emulation
+
+import (
+	"fmt"
+	"ratio-spoof/generator"
+	"regexp"
+	"sort"
+	"strings"
+
+	regen "github.com/zach-klippenstein/goregen"
+)
+
+const (
+	peerIdLength = 20
+	// peerIdSamples is how many peer ids are generated to check the regex always gives 20 bytes
+	peerIdSamples = 50
+)
+
+// knownPlaceholders are the query placeholders replaced by BuildQuery
+var knownPlaceholders = []string{"infohash", "peerid", "port", "uploaded", "downloaded", "left", "key", "event", "numwant", "ip", "ipv4", "ipv6"}
+
+// knownEvents are the events a profile can override values for
+var knownEvents = []string{"started", "completed", "stopped"}
+
+// mandatoryPlaceholders are the ones every tracker expects in an announce
+var mandatoryPlaceholders = []string{"infohash", "peerid", "port", "uploaded", "downloaded", "left"}
+
+var placeholderRegex = regexp.MustCompile(`\{[^{}]*\}`)
+
+// ValidationError lists every problem found in a profile
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid profile: " + strings.Join(e.Problems, ", ")
+}
+
+// Validate checks the profile has every required field, a peer id regex generating 20 bytes and a
+// query using only known placeholders, it returns a *ValidationError with every problem found
+func (c *ClientInfo) Validate() error {
+	var problems []string
+	if c.Name == "" {
+		problems = append(problems, "name is required")
+	}
+	if c.Key.Generator == "" && c.Key.Regex == "" {
+		problems = append(problems, "key generator or regex is required")
+	} else if !generator.KnownKey(c.Key) {
+		problems = append(problems, fmt.Sprintf("unknown key generator %q", c.Key.Generator))
+	}
+	if c.Rounding.Generator == "" {
+		problems = append(problems, "rounding generator is required")
+	} else if !generator.KnownRounding(c.Rounding) {
+		problems = append(problems, fmt.Sprintf("unknown rounding generator %q", c.Rounding.Generator))
+	} else if _, err := generator.NewRounding(c.Rounding); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, ok := c.Headers["User-Agent"]; !ok {
+		problems = append(problems, "User-Agent header is required")
+	}
+	if !generator.KnownPeerId(c.PeerID) {
+		problems = append(problems, fmt.Sprintf("unknown peer id generator %q", c.PeerID.Generator))
+	} else if c.PeerID.Generator == "" || c.PeerID.Generator == generator.RegexPeerId {
+		problems = append(problems, validatePeerIdRegex(c.PeerID.Regex)...)
+	}
+	for _, g := range []struct {
+		name string
+		cfg  generator.Config
+	}{{"peer id", c.PeerID}, {"key", c.Key}} {
+		if g.cfg.Lifecycle != "" && !contains(generator.Lifecycles(), g.cfg.Lifecycle) {
+			problems = append(problems, fmt.Sprintf("%s lifecycle must be one of %v, got %q", g.name, generator.Lifecycles(), g.cfg.Lifecycle))
+		}
+	}
+	problems = append(problems, validateQuery(c.Query)...)
+	problems = append(problems, validateEvents(c.Events)...)
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func validatePeerIdRegex(pattern string) []string {
+	if pattern == "" {
+		return []string{"peer id regex is required"}
+	}
+	if _, err := regexp.Compile(pattern); err != nil {
+		return []string{fmt.Sprintf("peer id regex does not compile: %v", err)}
+	}
+	generator, err := regen.NewGenerator(pattern, nil)
+	if err != nil {
+		return []string{fmt.Sprintf("peer id regex can not generate ids: %v", err)}
+	}
+	for i := 0; i < peerIdSamples; i++ {
+		if peerId := generator.Generate(); len(peerId) != peerIdLength {
+			return []string{fmt.Sprintf("peer id regex generated %q which is %d bytes instead of %d", peerId, len(peerId), peerIdLength)}
+		}
+	}
+	return nil
+}
+
+func validateQuery(query string) []string {
+	if query == "" {
+		return []string{"query is required"}
+	}
+	var problems []string
+	used := make(map[string]bool)
+	for _, placeholder := range placeholderRegex.FindAllString(query, -1) {
+		name, _ := placeholderName(placeholder)
+		if !contains(knownPlaceholders, name) {
+			problems = append(problems, fmt.Sprintf("unknown placeholder %s", placeholder))
+		}
+		used[name] = true
+	}
+	for _, name := range mandatoryPlaceholders {
+		if !used[name] {
+			problems = append(problems, fmt.Sprintf("query is missing the {%s} placeholder", name))
+		}
+	}
+	return problems
+}
+
+func validateEvents(events map[string]EventOverride) []string {
+	var problems []string
+	for _, event := range knownEvents {
+		if override, ok := events[event]; ok && override.NumWant != nil && *override.NumWant < 0 {
+			problems = append(problems, fmt.Sprintf("%s numwant can not be negative", event))
+		}
+	}
+	var unknown []string
+	for event := range events {
+		if !contains(knownEvents, event) {
+			unknown = append(unknown, event)
+		}
+	}
+	sort.Strings(unknown)
+	for _, event := range unknown {
+		problems = append(problems, fmt.Sprintf("unknown event %q, must be one of %v", event, knownEvents))
+	}
+	return problems
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
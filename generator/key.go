@@ -1,14 +1,14 @@
 package generator
 
 import (
-	"crypto/rand"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"strings"
 )
 
 func NewDefaultKeyGenerator() (*DefaultKeyGenerator, error) {
-	randomBytes := make([]byte, 4)
-	rand.Read(randomBytes)
+	randomBytes := readRandom(4)
 	str := hex.EncodeToString(randomBytes)
 	result := strings.ToUpper(str)
 	return &DefaultKeyGenerator{generated: result}, nil
@@ -21,3 +21,72 @@ type DefaultKeyGenerator struct {
 func (d *DefaultKeyGenerator) Key() string {
 	return d.generated
 }
+
+const defaultKeyLength = 8
+
+// HexKeyGenerator generates uppercase hex keys of a configurable length
+type HexKeyGenerator struct {
+	generated string
+}
+
+func NewHexKeyGenerator(length int) (*HexKeyGenerator, error) {
+	if length == 0 {
+		length = defaultKeyLength
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("key length can not be negative, got %d", length)
+	}
+	randomBytes := readRandom((length + 1) / 2)
+	return &HexKeyGenerator{generated: strings.ToUpper(hex.EncodeToString(randomBytes))[:length]}, nil
+}
+
+func (h *HexKeyGenerator) Key() string {
+	return h.generated
+}
+
+// NumericKeyGenerator generates decimal keys of a configurable length, without leading zero
+type NumericKeyGenerator struct {
+	generated string
+}
+
+func NewNumericKeyGenerator(length int) (*NumericKeyGenerator, error) {
+	if length == 0 {
+		length = defaultKeyLength
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("key length can not be negative, got %d", length)
+	}
+	randomBytes := readRandom(length)
+	digits := make([]byte, length)
+	for idx, b := range randomBytes {
+		digits[idx] = '0' + b%10
+	}
+	if digits[0] == '0' {
+		digits[0] = '1' + randomBytes[0]%9
+	}
+	return &NumericKeyGenerator{generated: string(digits)}, nil
+}
+
+func (n *NumericKeyGenerator) Key() string {
+	return n.generated
+}
+
+// RegexKeyGenerator generates keys matching a regex, as the peer ids
+type RegexKeyGenerator struct {
+	generated string
+}
+
+func NewRegexKeyGenerator(pattern string) (*RegexKeyGenerator, error) {
+	if pattern == "" {
+		return nil, errors.New("key regex is required")
+	}
+	result, err := generateRegex(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &RegexKeyGenerator{generated: result}, nil
+}
+
+func (r *RegexKeyGenerator) Key() string {
+	return r.generated
+}
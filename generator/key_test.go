@@ -1,6 +1,9 @@
 package generator
 
-import "testing"
+import (
+	"regexp"
+	"testing"
+)
 
 func TestDeaultKeyGenerator(t *testing.T) {
 	t.Run("Key has 8 length", func(t *testing.T) {
@@ -12,3 +15,37 @@ func TestDeaultKeyGenerator(t *testing.T) {
 
 	})
 }
+
+func TestKeyGenerators(t *testing.T) {
+	data := []struct {
+		name    string
+		new     func() (KeyGenerator, error)
+		pattern string
+	}{
+		{"hex default length", func() (KeyGenerator, error) { return NewHexKeyGenerator(0) }, "^[0-9A-F]{8}$"},
+		{"hex odd length", func() (KeyGenerator, error) { return NewHexKeyGenerator(5) }, "^[0-9A-F]{5}$"},
+		{"numeric default length", func() (KeyGenerator, error) { return NewNumericKeyGenerator(0) }, "^[1-9][0-9]{7}$"},
+		{"numeric length", func() (KeyGenerator, error) { return NewNumericKeyGenerator(10) }, "^[1-9][0-9]{9}$"},
+		{"regex", func() (KeyGenerator, error) { return NewRegexKeyGenerator("[a-z]{6}") }, "^[a-z]{6}$"},
+	}
+	for _, td := range data {
+		t.Run(td.name, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				g, err := td.new()
+				if err != nil {
+					t.Fatalf("should not return error: %v", err)
+				}
+				if !regexp.MustCompile(td.pattern).MatchString(g.Key()) {
+					t.Fatalf("got %q want a match of %s", g.Key(), td.pattern)
+				}
+			}
+		})
+	}
+
+	if _, err := NewHexKeyGenerator(-1); err == nil {
+		t.Error("negative length should return error")
+	}
+	if _, err := NewRegexKeyGenerator(""); err == nil {
+		t.Error("empty regex should return error")
+	}
+}
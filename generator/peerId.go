@@ -1,15 +1,11 @@
 package generator
 
-import (
-	regen "github.com/zach-klippenstein/goregen"
-)
-
 type RegexPeerIdGenerator struct {
 	generated string
 }
 
 func NewRegexPeerIdGenerator(pattern string) (*RegexPeerIdGenerator, error) {
-	result, err := regen.Generate(pattern)
+	result, err := generateRegex(pattern)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,55 @@
+package generator
+
+import (
+	"crypto/rand"
+	mathrand "math/rand"
+	"sync"
+
+	regen "github.com/zach-klippenstein/goregen"
+)
+
+var (
+	seededMu sync.Mutex
+	// seeded replaces crypto/rand and the randomness of the regex generators when set
+	seeded *mathrand.Rand
+)
+
+// Seed makes the generated peer ids and keys reproducible until Unseed is called, it is meant for the
+// tests pinning what each profile generates
+func Seed(seed int64) {
+	seededMu.Lock()
+	defer seededMu.Unlock()
+	seeded = mathrand.New(mathrand.NewSource(seed))
+}
+
+// Unseed goes back to generating unpredictable peer ids and keys
+func Unseed() {
+	seededMu.Lock()
+	defer seededMu.Unlock()
+	seeded = nil
+}
+
+func readRandom(n int) []byte {
+	b := make([]byte, n)
+	seededMu.Lock()
+	defer seededMu.Unlock()
+	if seeded != nil {
+		seeded.Read(b)
+	} else {
+		rand.Read(b)
+	}
+	return b
+}
+
+func generateRegex(pattern string) (string, error) {
+	seededMu.Lock()
+	defer seededMu.Unlock()
+	if seeded == nil {
+		return regen.Generate(pattern)
+	}
+	g, err := regen.NewGenerator(pattern, &regen.GeneratorArgs{RngSource: seeded})
+	if err != nil {
+		return "", err
+	}
+	return g.Generate(), nil
+}
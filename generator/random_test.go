@@ -0,0 +1,23 @@
+package generator
+
+import "testing"
+
+func TestSeed(t *testing.T) {
+	generate := func() (string, string) {
+		key, _ := NewHexKeyGenerator(8)
+		peerId, _ := NewRegexPeerIdGenerator("-XX0000-[A-Za-z0-9]{12}")
+		return key.Key(), peerId.PeerId()
+	}
+	defer Unseed()
+
+	Seed(1)
+	key, peerId := generate()
+	Seed(1)
+	if gotKey, gotPeerId := generate(); gotKey != key || gotPeerId != peerId {
+		t.Errorf("got %q %q want the seeded %q %q", gotKey, gotPeerId, key, peerId)
+	}
+	Seed(2)
+	if gotKey, gotPeerId := generate(); gotKey == key && gotPeerId == peerId {
+		t.Errorf("another seed should generate other values, got %q %q", gotKey, gotPeerId)
+	}
+}
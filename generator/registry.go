@@ -0,0 +1,205 @@
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Config is a generator as declared in an emulation profile
+type Config struct {
+	Generator string `json:"generator,omitempty"`
+	Regex     string `json:"regex,omitempty"`
+	// Length is the number of characters of generated keys, generators have their own default
+	Length int `json:"length,omitempty"`
+	// BlockSize is the unit in bytes the uploaded amount is rounded to, 16 KiB by default
+	BlockSize int `json:"blockSize,omitempty"`
+	// Downloaded and Left round the amounts to RoundNone, RoundBlock or RoundPiece
+	Downloaded string `json:"downloaded,omitempty"`
+	Left       string `json:"left,omitempty"`
+	// Lifecycle tells when a peer id or key is generated again, LifecycleTorrent by default
+	Lifecycle string `json:"lifecycle,omitempty"`
+}
+
+// Lifecycles of the peer ids and keys
+const (
+	// LifecycleProcess shares one value between every torrent of the process
+	LifecycleProcess = "process"
+	// LifecycleTorrent generates one value per torrent
+	LifecycleTorrent = "torrent"
+	// LifecycleStopped generates one value per torrent and a new one after each stopped announce
+	LifecycleStopped = "stopped"
+)
+
+// Lifecycles returns the lifecycles a profile can declare
+func Lifecycles() []string {
+	return []string{LifecycleProcess, LifecycleTorrent, LifecycleStopped}
+}
+
+type KeyGenerator interface {
+	Key() string
+}
+
+type PeerIdGenerator interface {
+	PeerId() string
+}
+
+type RoundingGenerator interface {
+	Round(downloadCandidateNextAmount, uploadCandidateNextAmount, leftCandidateNextAmount, pieceSize int) (downloaded, uploaded, left int)
+}
+
+type KeyFactory func(cfg Config) (KeyGenerator, error)
+type PeerIdFactory func(cfg Config) (PeerIdGenerator, error)
+type RoundingFactory func(cfg Config) (RoundingGenerator, error)
+
+const (
+	DefaultKey      = "defaultKeyGenerator"
+	HexKey          = "hexKeyGenerator"
+	NumericKey      = "numericKeyGenerator"
+	RegexKey        = "regexKeyGenerator"
+	RegexPeerId     = "regexPeerIdGenerator"
+	DefaultRounding = "defaultRoudingGenerator"
+	NoRounding      = "noRoundingGenerator"
+)
+
+var (
+	registryMu sync.RWMutex
+
+	keyFactories = map[string]KeyFactory{
+		DefaultKey: func(cfg Config) (KeyGenerator, error) { return NewDefaultKeyGenerator() },
+		HexKey:     func(cfg Config) (KeyGenerator, error) { return NewHexKeyGenerator(cfg.Length) },
+		NumericKey: func(cfg Config) (KeyGenerator, error) { return NewNumericKeyGenerator(cfg.Length) },
+		RegexKey:   func(cfg Config) (KeyGenerator, error) { return NewRegexKeyGenerator(cfg.Regex) },
+	}
+	peerIdFactories = map[string]PeerIdFactory{
+		RegexPeerId: func(cfg Config) (PeerIdGenerator, error) { return NewRegexPeerIdGenerator(cfg.Regex) },
+	}
+	roundingFactories = map[string]RoundingFactory{
+		DefaultRounding: func(cfg Config) (RoundingGenerator, error) { return NewRoundingGenerator(cfg) },
+		// the name without the typo kept by the embedded profiles
+		"defaultRoundingGenerator": func(cfg Config) (RoundingGenerator, error) { return NewRoundingGenerator(cfg) },
+		NoRounding:                 func(cfg Config) (RoundingGenerator, error) { return &NoRoundingGenerator{}, nil },
+	}
+)
+
+// RegisterKeyGenerator makes a key generator available to the profiles under name
+func RegisterKeyGenerator(name string, factory KeyFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	keyFactories[name] = factory
+}
+
+// RegisterPeerIdGenerator makes a peer id generator available to the profiles under name
+func RegisterPeerIdGenerator(name string, factory PeerIdFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	peerIdFactories[name] = factory
+}
+
+// RegisterRoundingGenerator makes a rounding generator available to the profiles under name
+func RegisterRoundingGenerator(name string, factory RoundingFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	roundingFactories[name] = factory
+}
+
+// NewKey builds the key generator of the config, a config with only a regex uses RegexKey
+func NewKey(cfg Config) (KeyGenerator, error) {
+	registryMu.RLock()
+	factory, ok := keyFactories[keyName(cfg)]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown key generator %q, must be one of %v", cfg.Generator, KeyGenerators())
+	}
+	return factory(cfg)
+}
+
+// NewPeerId builds the peer id generator of the config, a config without generator uses RegexPeerId
+func NewPeerId(cfg Config) (PeerIdGenerator, error) {
+	registryMu.RLock()
+	factory, ok := peerIdFactories[peerIdName(cfg)]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown peer id generator %q, must be one of %v", cfg.Generator, PeerIdGenerators())
+	}
+	return factory(cfg)
+}
+
+// NewRounding builds the rounding generator of the config
+func NewRounding(cfg Config) (RoundingGenerator, error) {
+	registryMu.RLock()
+	factory, ok := roundingFactories[cfg.Generator]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown rounding generator %q, must be one of %v", cfg.Generator, RoundingGenerators())
+	}
+	return factory(cfg)
+}
+
+// KnownKey tells if the key generator of the config is registered
+func KnownKey(cfg Config) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	_, ok := keyFactories[keyName(cfg)]
+	return ok
+}
+
+// KnownPeerId tells if the peer id generator of the config is registered
+func KnownPeerId(cfg Config) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	_, ok := peerIdFactories[peerIdName(cfg)]
+	return ok
+}
+
+// KnownRounding tells if the rounding generator of the config is registered
+func KnownRounding(cfg Config) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	_, ok := roundingFactories[cfg.Generator]
+	return ok
+}
+
+// KeyGenerators returns the registered key generator names
+func KeyGenerators() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return names(keyFactories)
+}
+
+// PeerIdGenerators returns the registered peer id generator names
+func PeerIdGenerators() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return names(peerIdFactories)
+}
+
+// RoundingGenerators returns the registered rounding generator names
+func RoundingGenerators() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return names(roundingFactories)
+}
+
+func keyName(cfg Config) string {
+	if cfg.Generator == "" && cfg.Regex != "" {
+		return RegexKey
+	}
+	return cfg.Generator
+}
+
+func peerIdName(cfg Config) string {
+	if cfg.Generator == "" {
+		return RegexPeerId
+	}
+	return cfg.Generator
+}
+
+func names[T any](factories map[string]T) []string {
+	result := make([]string, 0, len(factories))
+	for name := range factories {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
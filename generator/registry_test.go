@@ -0,0 +1,81 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type fixedKey string
+
+func (f fixedKey) Key() string { return string(f) }
+
+func TestRegistry(t *testing.T) {
+	t.Run("Generators are resolved by name", func(t *testing.T) {
+		data := []struct {
+			cfg  Config
+			want string
+		}{
+			{Config{Generator: DefaultKey}, "*generator.DefaultKeyGenerator"},
+			{Config{Generator: HexKey, Length: 16}, "*generator.HexKeyGenerator"},
+			{Config{Generator: NumericKey}, "*generator.NumericKeyGenerator"},
+			{Config{Regex: "[a-z]{8}"}, "*generator.RegexKeyGenerator"},
+		}
+		for _, td := range data {
+			g, err := NewKey(td.cfg)
+			if err != nil {
+				t.Fatalf("should not return error: %v", err)
+			}
+			if got := typeName(g); got != td.want {
+				t.Errorf("got %v want %v", got, td.want)
+			}
+		}
+
+		peerId, err := NewPeerId(Config{Regex: "-qB5040-[a-z]{12}"})
+		if err != nil || typeName(peerId) != "*generator.RegexPeerIdGenerator" {
+			t.Errorf("got %v %v", typeName(peerId), err)
+		}
+		for name, want := range map[string]string{
+			DefaultRounding:            "*generator.DefaultRoundingGenerator",
+			"defaultRoundingGenerator": "*generator.DefaultRoundingGenerator",
+			NoRounding:                 "*generator.NoRoundingGenerator",
+		} {
+			rounding, err := NewRounding(Config{Generator: name})
+			if err != nil || typeName(rounding) != want {
+				t.Errorf("%s: got %v %v want %v", name, typeName(rounding), err, want)
+			}
+		}
+	})
+
+	t.Run("Unknown names return errors", func(t *testing.T) {
+		if _, err := NewKey(Config{Generator: "uuid"}); err == nil || !strings.HasPrefix(err.Error(), `unknown key generator "uuid"`) {
+			t.Errorf("got: %v", err)
+		}
+		if _, err := NewPeerId(Config{Generator: "uuid"}); err == nil || !strings.HasPrefix(err.Error(), `unknown peer id generator "uuid"`) {
+			t.Errorf("got: %v", err)
+		}
+		if _, err := NewRounding(Config{}); err == nil || !strings.HasPrefix(err.Error(), `unknown rounding generator ""`) {
+			t.Errorf("got: %v", err)
+		}
+	})
+
+	t.Run("Registered generators can be used", func(t *testing.T) {
+		RegisterKeyGenerator("fixedKeyGenerator", func(cfg Config) (KeyGenerator, error) { return fixedKey("KEY"), nil })
+		defer func() {
+			registryMu.Lock()
+			delete(keyFactories, "fixedKeyGenerator")
+			registryMu.Unlock()
+		}()
+		g, err := NewKey(Config{Generator: "fixedKeyGenerator"})
+		if err != nil || g.Key() != "KEY" {
+			t.Errorf("got %v %v", g, err)
+		}
+		if !KnownKey(Config{Generator: "fixedKeyGenerator"}) {
+			t.Error("registered generator should be known")
+		}
+	})
+}
+
+func typeName(v interface{}) string {
+	return fmt.Sprintf("%T", v)
+}
@@ -1,16 +1,90 @@
 package generator
 
-type DefaultRoundingGenerator struct{}
+import "fmt"
 
+const defaultBlockSize = 16 * 1024
+
+// Rounding modes of the downloaded and left counters
+const (
+	RoundNone  = "none"
+	RoundBlock = "block"
+	RoundPiece = "piece"
+)
+
+// DefaultRoundingGenerator rounds the uploaded amount down to the block size and the downloaded and left
+// amounts down to the block or piece size, as the emulated client reports them
+type DefaultRoundingGenerator struct {
+	BlockSize  int
+	Downloaded string
+	Left       string
+}
+
+// NewDefaultRoudingGenerator rounds the upload to 16 KiB blocks, left to the piece size and leaves
+// downloaded as it is
 func NewDefaultRoudingGenerator() (*DefaultRoundingGenerator, error) {
-	return &DefaultRoundingGenerator{}, nil
+	return &DefaultRoundingGenerator{BlockSize: defaultBlockSize, Downloaded: RoundNone, Left: RoundPiece}, nil
+}
 
+// NewRoundingGenerator applies the block size and rounding modes of the config on top of the defaults
+func NewRoundingGenerator(cfg Config) (*DefaultRoundingGenerator, error) {
+	r, _ := NewDefaultRoudingGenerator()
+	if cfg.BlockSize < 0 {
+		return nil, fmt.Errorf("rounding block size can not be negative, got %d", cfg.BlockSize)
+	}
+	if cfg.BlockSize > 0 {
+		r.BlockSize = cfg.BlockSize
+	}
+	for _, mode := range []struct {
+		name  string
+		value string
+		field *string
+	}{{"downloaded", cfg.Downloaded, &r.Downloaded}, {"left", cfg.Left, &r.Left}} {
+		switch mode.value {
+		case "":
+		case RoundNone, RoundBlock, RoundPiece:
+			*mode.field = mode.value
+		default:
+			return nil, fmt.Errorf("%s rounding must be %q, %q or %q, got %q", mode.name, RoundNone, RoundBlock, RoundPiece, mode.value)
+		}
+	}
+	return r, nil
 }
 
+// Round never rounds the downloaded amount of a complete torrent so the completion is still reported. When
+// the downloaded amount is rounded left is what remains of the torrent, so both still add up to its size
+// as a real client reports them, and the left mode only applies to sessions with downloaded not rounded
 func (d *DefaultRoundingGenerator) Round(downloadCandidateNextAmount, uploadCandidateNextAmount, leftCandidateNextAmount, pieceSize int) (downloaded, uploaded, left int) {
 
 	down := downloadCandidateNextAmount
-	up := uploadCandidateNextAmount - (uploadCandidateNextAmount % (16 * 1024))
-	l := leftCandidateNextAmount - (leftCandidateNextAmount % pieceSize)
+	l := roundDown(leftCandidateNextAmount, d.unit(d.Left, pieceSize))
+	if unit := d.unit(d.Downloaded, pieceSize); unit > 0 && leftCandidateNextAmount > 0 {
+		down = roundDown(down, unit)
+		l = downloadCandidateNextAmount + leftCandidateNextAmount - down
+	}
+	up := roundDown(uploadCandidateNextAmount, d.BlockSize)
 	return down, up, l
 }
+
+func (d *DefaultRoundingGenerator) unit(mode string, pieceSize int) int {
+	switch mode {
+	case RoundBlock:
+		return d.BlockSize
+	case RoundPiece:
+		return pieceSize
+	}
+	return 0
+}
+
+func roundDown(amount, unit int) int {
+	if unit <= 0 {
+		return amount
+	}
+	return amount - (amount % unit)
+}
+
+// NoRoundingGenerator reports the amounts as they are
+type NoRoundingGenerator struct{}
+
+func (n *NoRoundingGenerator) Round(downloadCandidateNextAmount, uploadCandidateNextAmount, leftCandidateNextAmount, pieceSize int) (downloaded, uploaded, left int) {
+	return downloadCandidateNextAmount, uploadCandidateNextAmount, leftCandidateNextAmount
+}
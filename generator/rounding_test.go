@@ -1,6 +1,9 @@
 package generator
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestDefaultRounding(t *testing.T) {
 	r, _ := NewDefaultRoudingGenerator()
@@ -19,3 +22,101 @@ func TestDefaultRounding(t *testing.T) {
 		t.Errorf("[left]got %v want %v", l, 7879680)
 	}
 }
+
+func TestNoRounding(t *testing.T) {
+	r := &NoRoundingGenerator{}
+	d, u, l := r.Round(656497856, 46479878, 7879879, 1024)
+	if d != 656497856 || u != 46479878 || l != 7879879 {
+		t.Errorf("got %v %v %v want the amounts unchanged", d, u, l)
+	}
+}
+
+func TestRoundingGenerator(t *testing.T) {
+	data := []struct {
+		name                       string
+		cfg                        Config
+		downloaded, uploaded, left int
+		wantD, wantU, wantL        int
+	}{
+		{
+			name:       "defaults match the default generator",
+			cfg:        Config{},
+			downloaded: 656497856, uploaded: 46479878, left: 7879879,
+			wantD: 656497856, wantU: 46465024, wantL: 7879680,
+		},
+		{
+			name:       "block size",
+			cfg:        Config{BlockSize: 1000},
+			downloaded: 656497856, uploaded: 46479878, left: 7879879,
+			wantD: 656497856, wantU: 46479000, wantL: 7879680,
+		},
+		{
+			name:       "downloaded rounded to the block size",
+			cfg:        Config{Downloaded: RoundBlock},
+			downloaded: 656497856, uploaded: 46479878, left: 7879879,
+			wantD: 656490496, wantU: 46465024, wantL: 7887239,
+		},
+		{
+			name:       "downloaded rounded to the piece size",
+			cfg:        Config{Downloaded: RoundPiece},
+			downloaded: 656497999, uploaded: 46479878, left: 7879879,
+			wantD: 656497664, wantU: 46465024, wantL: 7880214,
+		},
+		{
+			name:       "left follows the rounded downloaded amount",
+			cfg:        Config{Downloaded: RoundBlock, Left: RoundBlock},
+			downloaded: 656497856, uploaded: 46479878, left: 7879879,
+			wantD: 656490496, wantU: 46465024, wantL: 7887239,
+		},
+		{
+			name:       "left rounded to the block size",
+			cfg:        Config{Left: RoundBlock},
+			downloaded: 656497856, uploaded: 46479878, left: 7879879,
+			wantD: 656497856, wantU: 46465024, wantL: 7864320,
+		},
+		{
+			name:       "left not rounded",
+			cfg:        Config{Left: RoundNone},
+			downloaded: 656497856, uploaded: 46479878, left: 7879879,
+			wantD: 656497856, wantU: 46465024, wantL: 7879879,
+		},
+		{
+			name:       "complete torrent keeps its downloaded amount",
+			cfg:        Config{Downloaded: RoundBlock},
+			downloaded: 656497856, uploaded: 46479878, left: 0,
+			wantD: 656497856, wantU: 46465024, wantL: 0,
+		},
+	}
+	for _, td := range data {
+		t.Run(td.name, func(t *testing.T) {
+			r, err := NewRoundingGenerator(td.cfg)
+			if err != nil {
+				t.Fatalf("should not return error: %v", err)
+			}
+			d, u, l := r.Round(td.downloaded, td.uploaded, td.left, 1024)
+			if d != td.wantD || u != td.wantU || l != td.wantL {
+				t.Errorf("got %v %v %v want %v %v %v", d, u, l, td.wantD, td.wantU, td.wantL)
+			}
+			if td.cfg.Downloaded != "" && td.cfg.Downloaded != RoundNone && d+l != td.downloaded+td.left {
+				t.Errorf("got downloaded %v and left %v adding up to %v want the torrent size %v", d, l, d+l, td.downloaded+td.left)
+			}
+		})
+	}
+}
+
+func TestRoundingGeneratorErrors(t *testing.T) {
+	data := []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{BlockSize: -1}, "rounding block size can not be negative, got -1"},
+		{Config{Downloaded: "chunk"}, `downloaded rounding must be "none", "block" or "piece", got "chunk"`},
+		{Config{Left: "up"}, `left rounding must be "none", "block" or "piece", got "up"`},
+	}
+	for _, td := range data {
+		_, err := NewRoundingGenerator(td.cfg)
+		if err == nil || !strings.Contains(err.Error(), td.want) {
+			t.Errorf("got: %v want %v", err, td.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"ratio-spoof/input"
+	"ratio-spoof/printer"
+	"ratio-spoof/tracker"
+)
+
+func runInfo(args []string) int {
+	flags := flag.NewFlagSet("info", flag.ExitOnError)
+	magnetCache := flags.String("magnet-cache", "", "directory searched for the .torrent file of a magnet link")
+	flags.Usage = func() {
+		fmt.Printf("usage: %s info [-magnet-cache DIR] <TORRENT_PATH|URL|MAGNET_LINK|->\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitSetupError
+	}
+
+	httpClient, err := tracker.NewHTTPClient(tracker.ClientConfig{})
+	if err != nil {
+		fmt.Printf("Error building the http client: %v\n", err)
+		return exitSetupError
+	}
+	torrentInfo, err := input.SourceFromPath(flags.Arg(0), *magnetCache).TorrentInfo(httpClient)
+	if err != nil {
+		fmt.Printf("Error loading the torrent: %v\n", err)
+		return exitSetupError
+	}
+	printer.PrintTorrentInfo(os.Stdout, torrentInfo)
+	return 0
+}
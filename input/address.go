@@ -0,0 +1,64 @@
+package input
+
+import (
+	"fmt"
+	"net"
+	"ratio-spoof/tracker"
+)
+
+// AutoAddress detects the announced address from the public addresses of the local interfaces
+const AutoAddress = "auto"
+
+// resolveAnnounceAddresses returns the ip, ipv4 and ipv6 announce parameters, each one is given as is,
+// detected when set to AutoAddress or left out when empty. The ip parameter can also be a host name
+func resolveAnnounceAddresses(ip, ipv4, ipv6, iface string) (string, string, string, error) {
+	var err error
+	if ipv4, err = resolveAddress(ipv4, false, iface); err != nil {
+		return "", "", "", err
+	}
+	if ipv6, err = resolveAddress(ipv6, true, iface); err != nil {
+		return "", "", "", err
+	}
+	if ip == AutoAddress {
+		if ip, err = resolveAddress(ip, false, iface); err == nil && ip == "" {
+			ip, err = resolveAddress(AutoAddress, true, iface)
+		}
+		if err != nil {
+			return "", "", "", err
+		}
+	}
+	return ip, ipv4, ipv6, nil
+}
+
+func resolveAddress(address string, ipv6 bool, iface string) (string, error) {
+	if address != AutoAddress {
+		return address, nil
+	}
+	ip, err := tracker.LocalAddress(ipv6, iface)
+	if err != nil {
+		return "", fmt.Errorf("failed to detect the %s address: %w", familyName(ipv6), err)
+	}
+	if ip == nil {
+		return "", nil
+	}
+	return ip.String(), nil
+}
+
+// validateAddress checks an announced address is an ip of the expected family
+func validateAddress(address string, ipv6 bool) error {
+	if address == "" {
+		return nil
+	}
+	ip := net.ParseIP(address)
+	if ip == nil || (ip.To4() == nil) != ipv6 {
+		return fmt.Errorf("%s %q is not an %s address", familyName(ipv6), address, familyName(ipv6))
+	}
+	return nil
+}
+
+func familyName(ipv6 bool) string {
+	if ipv6 {
+		return "ipv6"
+	}
+	return "ipv4"
+}
@@ -0,0 +1,53 @@
+package input
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolveAnnounceAddresses(T *testing.T) {
+	ip, ipv4, ipv6, err := resolveAnnounceAddresses("tracker.example.org", "203.0.113.7", "", "")
+	if err != nil {
+		T.Fatalf("should not return error: %v", err)
+	}
+	if ip != "tracker.example.org" || ipv4 != "203.0.113.7" || ipv6 != "" {
+		T.Errorf("got %v %v %v", ip, ipv4, ipv6)
+	}
+
+	_, _, _, err = resolveAnnounceAddresses(AutoAddress, AutoAddress, AutoAddress, "no-such-interface0")
+	if err == nil {
+		T.Error("should return error for an unknown interface")
+	}
+	if _, _, _, err = resolveAnnounceAddresses("", "", "", "no-such-interface0"); err != nil {
+		T.Errorf("addresses that are not detected should not look up the interface: %v", err)
+	}
+
+	ip, ipv4, ipv6, err = resolveAnnounceAddresses(AutoAddress, AutoAddress, AutoAddress, "127.0.0.1")
+	if err != nil {
+		T.Fatalf("an interface given by its ip address should be found: %v", err)
+	}
+	if ip != "" || ipv4 != "" || ipv6 != "" {
+		T.Errorf("got %v %v %v want no public address on the loopback interface", ip, ipv4, ipv6)
+	}
+}
+
+func TestValidateAddress(T *testing.T) {
+	data := []struct {
+		address string
+		ipv6    bool
+		err     error
+	}{
+		{address: "", ipv6: false},
+		{address: "203.0.113.7", ipv6: false},
+		{address: "2001:db8::1", ipv6: true},
+		{address: "2001:db8::1", ipv6: false, err: errors.New(`ipv4 "2001:db8::1" is not an ipv4 address`)},
+		{address: "203.0.113.7", ipv6: true, err: errors.New(`ipv6 "203.0.113.7" is not an ipv6 address`)},
+		{address: "auto", ipv6: true, err: errors.New(`ipv6 "auto" is not an ipv6 address`)},
+	}
+
+	for _, td := range data {
+		T.Run(td.address, func(t *testing.T) {
+			CheckError(validateAddress(td.address, td.ipv6), td.err, t)
+		})
+	}
+}
@@ -4,41 +4,81 @@ import (
 	"errors"
 	"fmt"
 	"ratio-spoof/bencode"
+	"ratio-spoof/tracker"
 	"strconv"
 	"strings"
 )
 
 const (
-	minPortNumber     = 1
-	maxPortNumber     = 65535
-	speedSuffixLength = 4
+	minPortNumber = 1
+	maxPortNumber = 65535
+
+	// AnnounceAllTiers announces to one url of every tier concurrently
+	AnnounceAllTiers = "tiers"
+	// AnnounceAllUrls announces to every url concurrently
+	AnnounceAllUrls = "urls"
+
+	// RetryForever keeps retrying failed announces until the tracker refuses the torrent
+	RetryForever = "forever"
+	// RetryFailFast stops at the first failed announce
+	RetryFailFast = "fail-fast"
 )
 
 type InputArgs struct {
-	Client             string
-	Debug              bool
-	DownloadSpeed      string
-	InitialDownloaded  string
-	InitialUploaded    string
-	Port               int
-	TorrentPath        string
-	UploadSpeed        string
-	WaitForLeechers    bool
+	AnnounceAll string
+	// AnnounceIP, AnnounceIPv4 and AnnounceIPv6 feed the {ip}, {ipv4} and {ipv6} query placeholders,
+	// AutoAddress detects them from the local interfaces
+	AnnounceIP     string
+	AnnounceIPv4   string
+	AnnounceIPv6   string
+	Client         string
+	Debug          bool
+	DryRun         bool
+	DryRunInterval int
+	DryRunPeers    string
+	// DualStack announces to every tracker over both ipv4 and ipv6
+	DualStack     bool
+	DownloadSpeed string
+	HttpClient    tracker.ClientConfig
+	// IdentitiesPath is the file keeping the peer ids and keys of the torrents between runs
+	IdentitiesPath    string
+	InitialDownloaded string
+	InitialUploaded   string
+	MagnetCacheDir    string
+	Port              int
+	ProfilesDir       string
+	RecordPath        string
+	RetryPolicy       string
+	TorrentPath       string
+	// TorrentSource is used instead of the TorrentPath when set
+	TorrentSource   TorrentSource
+	UploadSpeed     string
+	WaitForLeechers bool
 }
 
 type InputParsed struct {
-	Debug              bool
-	DownloadSpeed      int
-	InitialDownloaded  int
-	InitialUploaded    int
-	Port               int
-	TorrentPath        string
-	UploadSpeed        int
-	WaitForLeechers    bool
+	AnnounceAll       string
+	AnnounceIP        string
+	AnnounceIPv4      string
+	AnnounceIPv6      string
+	Debug             bool
+	DryRun            bool
+	DryRunInterval    int
+	DryRunSeeders     int
+	DryRunLeechers    int
+	DualStack         bool
+	DownloadSpeed     int
+	HttpClient        tracker.ClientConfig
+	InitialDownloaded int
+	InitialUploaded   int
+	MaxRetries        int
+	Port              int
+	RecordPath        string
+	TorrentPath       string
+	UploadSpeed       int
+	WaitForLeechers   bool
 }
 
-var validSpeedSufixes = [...]string{"kbps", "mbps"}
-
 func (i *InputArgs) ParseInput(torrentInfo *bencode.TorrentInfo) (*InputParsed, error) {
 	downloaded, err := extractInputInitialByteCount(i.InitialDownloaded, torrentInfo.TotalSize, true)
 	if err != nil {
@@ -57,47 +97,115 @@ func (i *InputArgs) ParseInput(torrentInfo *bencode.TorrentInfo) (*InputParsed,
 		return nil, err
 	}
 
-	if i.Port < minPortNumber || i.Port > maxPortNumber {
-		return nil, errors.New(fmt.Sprint("port number must be between %i and %i", minPortNumber, maxPortNumber))
+	maxRetries, err := extractRetryPolicy(i.RetryPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	var seeders, leechers int
+	if i.DryRun {
+		seeders, leechers, err = extractDryRunPeers(i.DryRunPeers)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ip, ipv4, ipv6, err := resolveAnnounceAddresses(i.AnnounceIP, i.AnnounceIPv4, i.AnnounceIPv6, i.HttpClient.SourceInterface)
+	if err != nil {
+		return nil, err
 	}
 
-	return &InputParsed{
+	parsed := &InputParsed{
+		AnnounceAll:       i.AnnounceAll,
+		AnnounceIP:        ip,
+		AnnounceIPv4:      ipv4,
+		AnnounceIPv6:      ipv6,
 		Debug:             i.Debug,
+		DryRun:            i.DryRun,
+		DryRunInterval:    i.DryRunInterval,
+		DryRunSeeders:     seeders,
+		DryRunLeechers:    leechers,
+		DualStack:         i.DualStack,
 		DownloadSpeed:     downloadSpeed,
+		HttpClient:        i.HttpClient,
 		InitialDownloaded: downloaded,
 		InitialUploaded:   uploaded,
+		MaxRetries:        maxRetries,
 		Port:              i.Port,
+		RecordPath:        i.RecordPath,
 		TorrentPath:       i.TorrentPath,
 		UploadSpeed:       uploadSpeed,
 		WaitForLeechers:   i.WaitForLeechers,
-	}, nil
+	}
+	if err := parsed.Validate(torrentInfo.TotalSize); err != nil {
+		return nil, err
+	}
+	return parsed, nil
 }
 
-func checkSpeedSufix(input string) (valid bool, suffix string) {
-	for _, v := range validSpeedSufixes {
-		if strings.HasSuffix(strings.ToLower(input), v) {
-			return true, input[len(input)-4:]
+// Validate checks the typed values, whether they come from the command line or the library options
+func (p *InputParsed) Validate(totalSize int) error {
+	if p.InitialDownloaded < 0 || p.InitialUploaded < 0 {
+		return errors.New("initial value can not be negative")
+	}
+	if p.InitialDownloaded > totalSize {
+		return errors.New("initial downloaded can not be higher than the torrent size")
+	}
+	if p.DownloadSpeed < 0 || p.UploadSpeed < 0 {
+		return errors.New("speed can not be negative")
+	}
+
+	if p.Port < minPortNumber || p.Port > maxPortNumber {
+		return fmt.Errorf("port number must be between %d and %d", minPortNumber, maxPortNumber)
+	}
+
+	if p.AnnounceAll != "" && p.AnnounceAll != AnnounceAllTiers && p.AnnounceAll != AnnounceAllUrls {
+		return fmt.Errorf("announce-all must be %q or %q", AnnounceAllTiers, AnnounceAllUrls)
+	}
+
+	if err := validateAddress(p.AnnounceIPv4, false); err != nil {
+		return err
+	}
+	if err := validateAddress(p.AnnounceIPv6, true); err != nil {
+		return err
+	}
+	if p.DualStack && p.HttpClient.Network != "" {
+		return errors.New("dual-stack announces can not be forced to a single network")
+	}
+
+	if p.DryRun {
+		if p.DryRunInterval < 1 {
+			return errors.New("dry-run interval must be at least 1 second")
+		}
+		if p.DryRunSeeders < 0 || p.DryRunLeechers < 0 {
+			return errors.New("dry-run peers can not be negative")
 		}
 	}
-	return false, ""
+	return nil
 }
 
+// Takes an initial amount as a percentage of the torrent, a size or a byte count and returns the bytes
+// example 50%(string) > half the torrent size, 1.5GiB(string) > 1610612736 bytes (int)
 func extractInputInitialByteCount(initialSizeInput string, totalBytes int, errorIfHigher bool) (int, error) {
-	if !strings.HasSuffix(initialSizeInput, "%") {
-		return 0, errors.New("initial value must be in percentage")
-	}
-	
-	percent, err := strconv.ParseFloat(initialSizeInput[:len(initialSizeInput)-1], 64)
-	if err != nil {
-		return 0, errors.New("invalid percentage value")
-	}
-	
-	if percent < 0 || percent > 100 {
-		return 0, errors.New("percentage must be between 0 and 100")
+	var byteCount int
+	if strings.HasSuffix(initialSizeInput, "%") {
+		percent, err := strconv.ParseFloat(initialSizeInput[:len(initialSizeInput)-1], 64)
+		if err != nil {
+			return 0, errors.New("invalid percentage value")
+		}
+
+		if percent < 0 || percent > 100 {
+			return 0, errors.New("percentage must be between 0 and 100")
+		}
+		byteCount = int(float64(totalBytes) * percent / 100)
+	} else {
+		size, err := ParseSize(initialSizeInput)
+		if err != nil {
+			return 0, fmt.Errorf("initial value must be a percentage or a size: %w", err)
+		}
+		byteCount = size
 	}
-	
-	byteCount := int(float64(totalBytes) * percent / 100)
-	
+
 	if errorIfHigher && byteCount > totalBytes {
 		return 0, errors.New("initial downloaded can not be higher than the torrent size")
 	}
@@ -107,26 +215,56 @@ func extractInputInitialByteCount(initialSizeInput string, totalBytes int, error
 	return byteCount, nil
 }
 
-// Takes an dirty speed input and returns the bytes per second based on the suffixes
-// example 1kbps(string) > 1024 bytes per second (int)
+// Takes an dirty speed input and returns the bytes per second based on the units
+// example 1kbps(string) > 1024 bytes per second (int), 8Mbit/s(string) > 1000000 bytes per second (int)
 func extractInputByteSpeed(initialSpeedInput string) (int, error) {
-	ok, suffix := checkSpeedSufix(initialSpeedInput)
+	value, multiplier, ok := splitUnit(initialSpeedInput, speedUnits)
 	if !ok {
-		return 0, fmt.Errorf("speed must be in %v", validSpeedSufixes)
+		return 0, fmt.Errorf("speed must be in %v", unitNames(speedUnits))
 	}
-	speedVal, err := strconv.ParseFloat(initialSpeedInput[:len(initialSpeedInput)-speedSuffixLength], 64)
+	speedVal, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
 	if err != nil {
 		return 0, errors.New("invalid speed number")
 	}
 	if speedVal < 0 {
 		return 0, errors.New("speed can not be negative")
 	}
+	return int(speedVal * multiplier), nil
+}
 
-	if suffix == "kbps" {
-		speedVal *= 1024
-	} else {
-		speedVal = speedVal * 1024 * 1024
+// Takes the simulated swarm used in dry-run mode and returns the seeders and leechers
+// example 10:5(string) > 10 seeders, 5 leechers
+func extractDryRunPeers(peersInput string) (seeders, leechers int, err error) {
+	parts := strings.Split(peersInput, ":")
+	if len(parts) != 2 {
+		return 0, 0, errors.New("dry-run peers must be in the format <seeders>:<leechers>")
+	}
+	seeders, err = strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, errors.New("invalid dry-run seeders number")
+	}
+	leechers, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, errors.New("invalid dry-run leechers number")
+	}
+	if seeders < 0 || leechers < 0 {
+		return 0, 0, errors.New("dry-run peers can not be negative")
+	}
+	return seeders, leechers, nil
+}
+
+// Takes the retry policy and returns the number of retries after a failed announce, -1 meaning forever
+// example forever(string) > -1, fail-fast(string) > 0, 5(string) > 5
+func extractRetryPolicy(policyInput string) (int, error) {
+	switch policyInput {
+	case "", RetryForever:
+		return -1, nil
+	case RetryFailFast:
+		return 0, nil
+	}
+	retries, err := strconv.Atoi(policyInput)
+	if err != nil || retries < 0 {
+		return 0, fmt.Errorf("retry policy must be %q, %q or a number of retries", RetryForever, RetryFailFast)
 	}
-	ret := int(speedVal)
-	return ret, nil
+	return retries, nil
 }
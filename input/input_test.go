@@ -71,10 +71,23 @@ func TestExtractInputInitialByteCount(T *testing.T) {
 		},
 		{
 			name:            "Invalid format should return error test",
-			inSize:          "50kb",
+			inSize:          "50kg",
 			inTotal:         204800,
 			inErrorIfHigher: true,
-			err:             errors.New("initial value must be in percentage"),
+			err:             errors.New("initial value must be a percentage or a size: size must be a byte count or in [B KiB MiB GiB TiB kB MB GB TB]"),
+		},
+		{
+			name:            "[Downloaded] absolute size higher than the torrent should return error test",
+			inSize:          "1MiB",
+			inTotal:         204800,
+			inErrorIfHigher: true,
+			err:             errors.New("initial downloaded can not be higher than the torrent size"),
+		},
+		{
+			name:            "[Uploaded] absolute size higher than the torrent shouldn't return error test",
+			inSize:          "1MiB",
+			inTotal:         204800,
+			inErrorIfHigher: false,
 		},
 		{
 			name:            "Invalid percentage value should return error test",
@@ -115,10 +128,90 @@ func TestExtractInputByteSpeed(T *testing.T) {
 			speed:    "1mbps",
 			expected: 1048576,
 		},
+		{
+			name:     "1gbps test",
+			speed:    "1gbps",
+			expected: 1073741824,
+		},
+		{
+			name:     "uppercase 1MBPS test",
+			speed:    "1MBPS",
+			expected: 1048576,
+		},
+		{
+			name:     "512B/s test",
+			speed:    "512B/s",
+			expected: 512,
+		},
+		{
+			name:     "1.5KiB/s test",
+			speed:    "1.5KiB/s",
+			expected: 1536,
+		},
+		{
+			name:     "2MiB/s test",
+			speed:    "2MiB/s",
+			expected: 2097152,
+		},
+		{
+			name:     "1kB/s test",
+			speed:    "1kB/s",
+			expected: 1000,
+		},
+		{
+			name:     "3MB/s test",
+			speed:    "3MB/s",
+			expected: 3000000,
+		},
+		{
+			name:     "800kbit/s test",
+			speed:    "800kbit/s",
+			expected: 100000,
+		},
+		{
+			name:     "8Mbit/s test",
+			speed:    "8Mbit/s",
+			expected: 1000000,
+		},
+		{
+			name:     "8Mb/s test",
+			speed:    "8Mb/s",
+			expected: 1000000,
+		},
+		{
+			name:     "8MB/s test",
+			speed:    "8MB/s",
+			expected: 8000000,
+		},
+		{
+			name:     "lowercase 8mb/s test",
+			speed:    "8mb/s",
+			expected: 1000000,
+		},
+		{
+			name:     "800kb/s test",
+			speed:    "800kb/s",
+			expected: 100000,
+		},
+		{
+			name:     "1Gb/s test",
+			speed:    "1Gb/s",
+			expected: 125000000,
+		},
+		{
+			name:  "lowercase 1kib/s test",
+			speed: "1kib/s",
+			err:   errors.New("invalid speed number"),
+		},
 		{
 			name:  "2.5tbps test",
 			speed: "2.5tbps",
-			err:   errors.New("speed must be in [kbps mbps]"),
+			err:   errors.New("speed must be in [B/s KiB/s MiB/s GiB/s kB/s MB/s GB/s bit/s kbit/s Mbit/s Gbit/s b/s kb/s Mb/s Gb/s kbps mbps gbps]"),
+		},
+		{
+			name:  "number without unit test",
+			speed: "100",
+			err:   errors.New("speed must be in [B/s KiB/s MiB/s GiB/s kB/s MB/s GB/s bit/s kbit/s Mbit/s Gbit/s b/s kb/s Mb/s Gb/s kbps mbps gbps]"),
 		},
 		{
 			name:  "-akbps test",
@@ -147,3 +240,99 @@ func TestExtractInputByteSpeed(T *testing.T) {
 		})
 	}
 }
+
+func TestExtractDryRunPeers(T *testing.T) {
+	data := []struct {
+		name     string
+		peers    string
+		seeders  int
+		leechers int
+		err      error
+	}{
+		{
+			name:     "10:5 test",
+			peers:    "10:5",
+			seeders:  10,
+			leechers: 5,
+		},
+		{
+			name:  "missing separator test",
+			peers: "10",
+			err:   errors.New("dry-run peers must be in the format <seeders>:<leechers>"),
+		},
+		{
+			name:  "invalid leechers test",
+			peers: "10:a",
+			err:   errors.New("invalid dry-run leechers number"),
+		},
+		{
+			name:  "negative seeders test",
+			peers: "-1:5",
+			err:   errors.New("dry-run peers can not be negative"),
+		},
+	}
+
+	for _, td := range data {
+		T.Run(td.name, func(t *testing.T) {
+			seeders, leechers, err := extractDryRunPeers(td.peers)
+			CheckError(err, td.err, t)
+			if seeders != td.seeders || leechers != td.leechers {
+				t.Errorf("got %v:%v, want %v:%v", seeders, leechers, td.seeders, td.leechers)
+			}
+		})
+	}
+}
+
+func TestExtractRetryPolicy(T *testing.T) {
+	data := []struct {
+		name   string
+		policy string
+		want   int
+		err    error
+	}{
+		{name: "default retries forever", policy: "", want: -1},
+		{name: "forever", policy: "forever", want: -1},
+		{name: "fail-fast", policy: "fail-fast", want: 0},
+		{name: "number of retries", policy: "5", want: 5},
+		{name: "negative number", policy: "-5", err: errors.New(`retry policy must be "forever", "fail-fast" or a number of retries`)},
+		{name: "unknown policy", policy: "sometimes", err: errors.New(`retry policy must be "forever", "fail-fast" or a number of retries`)},
+	}
+
+	for _, td := range data {
+		T.Run(td.name, func(t *testing.T) {
+			got, err := extractRetryPolicy(td.policy)
+			CheckError(err, td.err, t)
+			if got != td.want {
+				t.Errorf("got %v, want %v", got, td.want)
+			}
+		})
+	}
+}
+
+func TestParseSize(T *testing.T) {
+	data := []struct {
+		size     string
+		expected int
+		err      error
+	}{
+		{size: "1024", expected: 1024},
+		{size: "10B", expected: 10},
+		{size: "1.5GiB", expected: 1610612736},
+		{size: "1.5gib", expected: 1610612736},
+		{size: "700MB", expected: 700000000},
+		{size: "2KiB", expected: 2048},
+		{size: "1TB", expected: 1000000000000},
+		{size: "-1GiB", err: errors.New("size can not be negative")},
+		{size: "GiB", err: errors.New("size must be a byte count or in [B KiB MiB GiB TiB kB MB GB TB]")},
+	}
+
+	for _, td := range data {
+		T.Run(td.size, func(t *testing.T) {
+			got, err := ParseSize(td.size)
+			CheckError(err, td.err, t)
+			if got != td.expected {
+				t.Errorf("got %v, want %v", got, td.expected)
+			}
+		})
+	}
+}
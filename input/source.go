@@ -0,0 +1,135 @@
+package input
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"ratio-spoof/bencode"
+	"ratio-spoof/magnet"
+	"strings"
+)
+
+// maxTorrentSize limits torrents read from stdin, readers and urls, real ones are a few MiB at most
+const maxTorrentSize = 32 * 1024 * 1024
+
+// StdinPath is the torrent path reading the torrent from the standard input
+const StdinPath = "-"
+
+// TorrentSource loads the torrent to announce, client is used by sources fetching it over http
+type TorrentSource interface {
+	TorrentInfo(client *http.Client) (*bencode.TorrentInfo, error)
+}
+
+// BytesSource is a torrent already in memory
+type BytesSource []byte
+
+func (s BytesSource) TorrentInfo(client *http.Client) (*bencode.TorrentInfo, error) {
+	return parseTorrent(s)
+}
+
+// ReaderSource reads the torrent from a reader, such as the standard input
+type ReaderSource struct {
+	Reader io.Reader
+}
+
+func (s ReaderSource) TorrentInfo(client *http.Client) (*bencode.TorrentInfo, error) {
+	dat, err := readTorrent(s.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return parseTorrent(dat)
+}
+
+// FileSource is the path of a .torrent file
+type FileSource string
+
+func (s FileSource) TorrentInfo(client *http.Client) (*bencode.TorrentInfo, error) {
+	dat, err := os.ReadFile(string(s))
+	if err != nil {
+		return nil, err
+	}
+	return parseTorrent(dat)
+}
+
+// URLSource is an http or https url the torrent is downloaded from
+type URLSource string
+
+func (s URLSource) TorrentInfo(client *http.Client) (*bencode.TorrentInfo, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(string(s))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download the torrent: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download the torrent: %s returned status %d", s, resp.StatusCode)
+	}
+	dat, err := readTorrent(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return parseTorrent(dat)
+}
+
+// MagnetSource is a magnet link, CacheDir is searched for its .torrent file
+type MagnetSource struct {
+	Link     string
+	CacheDir string
+}
+
+func (s MagnetSource) TorrentInfo(client *http.Client) (*bencode.TorrentInfo, error) {
+	link, err := magnet.Parse(s.Link)
+	if err != nil {
+		return nil, err
+	}
+	return link.TorrentInfo(s.CacheDir)
+}
+
+// SourceFromPath picks the source of the -t argument: a magnet link, an http(s) url, - for the
+// standard input or a file path
+func SourceFromPath(path, magnetCacheDir string) TorrentSource {
+	lowerPath := strings.ToLower(path)
+	switch {
+	case magnet.IsMagnet(path):
+		return MagnetSource{Link: path, CacheDir: magnetCacheDir}
+	case strings.HasPrefix(lowerPath, "http://") || strings.HasPrefix(lowerPath, "https://"):
+		return URLSource(path)
+	case path == StdinPath:
+		return ReaderSource{Reader: os.Stdin}
+	default:
+		return FileSource(path)
+	}
+}
+
+// Source is the TorrentSource when set, otherwise the one of the TorrentPath
+func (i *InputArgs) Source() TorrentSource {
+	if i.TorrentSource != nil {
+		return i.TorrentSource
+	}
+	return SourceFromPath(i.TorrentPath, i.MagnetCacheDir)
+}
+
+func readTorrent(r io.Reader) ([]byte, error) {
+	dat, err := io.ReadAll(io.LimitReader(r, maxTorrentSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(dat) > maxTorrentSize {
+		return nil, fmt.Errorf("torrent is bigger than %d bytes", maxTorrentSize)
+	}
+	return dat, nil
+}
+
+func parseTorrent(dat []byte) (*bencode.TorrentInfo, error) {
+	torrentInfo, err := bencode.TorrentDictParse(dat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the torrent file: %w", err)
+	}
+	if err := torrentInfo.Validate(); err != nil {
+		return nil, err
+	}
+	return torrentInfo, nil
+}
@@ -0,0 +1,95 @@
+package input
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testTorrent = "../bencode/torrent_files_test/debian-12.0.0-amd64-DVD-1.iso.torrent"
+
+func TestTorrentSources(T *testing.T) {
+	dat, err := os.ReadFile(testTorrent)
+	if err != nil {
+		T.Fatal(err)
+	}
+	want, err := FileSource(testTorrent).TorrentInfo(nil)
+	if err != nil {
+		T.Fatalf("should not return error: %v", err)
+	}
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/debian.torrent" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(dat)
+	}))
+	defer server.Close()
+
+	data := []struct {
+		name   string
+		source TorrentSource
+	}{
+		{"bytes", BytesSource(dat)},
+		{"reader", ReaderSource{Reader: bytes.NewReader(dat)}},
+		{"url", URLSource(server.URL + "/debian.torrent")},
+	}
+	for _, td := range data {
+		T.Run(td.name, func(t *testing.T) {
+			got, err := td.source.TorrentInfo(server.Client())
+			if err != nil {
+				t.Fatalf("should not return error: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got: %+v want %+v", got, want)
+			}
+		})
+	}
+	if requests != 1 {
+		T.Errorf("got: %v requests want 1", requests)
+	}
+
+	T.Run("url not found", func(t *testing.T) {
+		_, err := URLSource(server.URL + "/missing.torrent").TorrentInfo(server.Client())
+		if err == nil || !strings.Contains(err.Error(), "returned status 404") {
+			t.Errorf("got: %v", err)
+		}
+	})
+
+	T.Run("reader not bencoded", func(t *testing.T) {
+		_, err := ReaderSource{Reader: strings.NewReader("d8:announce")}.TorrentInfo(nil)
+		if err == nil {
+			t.Error("should return error")
+		}
+	})
+}
+
+func TestSourceFromPath(T *testing.T) {
+	data := []struct {
+		path string
+		want TorrentSource
+	}{
+		{"file.torrent", FileSource("file.torrent")},
+		{"https://example.com/file.torrent", URLSource("https://example.com/file.torrent")},
+		{"HTTP://example.com/file.torrent", URLSource("HTTP://example.com/file.torrent")},
+		{"magnet:?xt=urn:btih:abc", MagnetSource{Link: "magnet:?xt=urn:btih:abc", CacheDir: "cache"}},
+		{"-", ReaderSource{Reader: os.Stdin}},
+	}
+	for _, td := range data {
+		if got := SourceFromPath(td.path, "cache"); got != td.want {
+			T.Errorf("%s: got: %#v want %#v", td.path, got, td.want)
+		}
+	}
+
+	args := InputArgs{TorrentPath: "file.torrent", TorrentSource: BytesSource("d4:infodee")}
+	if _, ok := args.Source().(BytesSource); !ok {
+		T.Errorf("got: %#v want the TorrentSource", args.Source())
+	}
+}
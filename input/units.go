@@ -0,0 +1,104 @@
+package input
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type unit struct {
+	name  string
+	bytes float64
+}
+
+// speedUnits are matched case-insensitively but for the B of bytes and the b of bits before /s, so
+// Mb/s is an eighth of MB/s. kbps, mbps and gbps were the only units before and mean KiB/s, MiB/s and
+// GiB/s, not kilobits, they are kept with that meaning so existing commands keep announcing the same
+// amounts
+var speedUnits = []unit{
+	{"B/s", 1},
+	{"KiB/s", 1 << 10},
+	{"MiB/s", 1 << 20},
+	{"GiB/s", 1 << 30},
+	{"kB/s", 1e3},
+	{"MB/s", 1e6},
+	{"GB/s", 1e9},
+	{"bit/s", 1.0 / 8},
+	{"kbit/s", 1e3 / 8},
+	{"Mbit/s", 1e6 / 8},
+	{"Gbit/s", 1e9 / 8},
+	{"b/s", 1.0 / 8},
+	{"kb/s", 1e3 / 8},
+	{"Mb/s", 1e6 / 8},
+	{"Gb/s", 1e9 / 8},
+	{"kbps", 1 << 10},
+	{"mbps", 1 << 20},
+	{"gbps", 1 << 30},
+}
+
+// sizeUnits are matched case-insensitively, a number without unit is a byte count
+var sizeUnits = []unit{
+	{"B", 1},
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"TiB", 1 << 40},
+	{"kB", 1e3},
+	{"MB", 1e6},
+	{"GB", 1e9},
+	{"TB", 1e12},
+}
+
+// ParseSpeed returns the bytes per second of a speed such as 500KiB/s, 8Mbit/s or the legacy 3mbps
+func ParseSpeed(speed string) (int, error) {
+	return extractInputByteSpeed(speed)
+}
+
+// ParseSize returns the bytes of a size such as 1.5GiB, 700MB or a plain byte count
+func ParseSize(size string) (int, error) {
+	value, multiplier, ok := splitUnit(size, sizeUnits)
+	if !ok {
+		multiplier = 1
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("size must be a byte count or in %v", unitNames(sizeUnits))
+	}
+	if number < 0 {
+		return 0, errors.New("size can not be negative")
+	}
+	return int(number * multiplier), nil
+}
+
+// splitUnit separates the number from the longest unit it ends with
+func splitUnit(input string, units []unit) (value string, multiplier float64, ok bool) {
+	lower := strings.ToLower(input)
+	byLength := make([]unit, len(units))
+	copy(byLength, units)
+	sort.SliceStable(byLength, func(i, j int) bool { return len(byLength[i].name) > len(byLength[j].name) })
+	for _, u := range byLength {
+		if strings.HasSuffix(lower, strings.ToLower(u.name)) && sameByteSymbol(input, u.name) {
+			return input[:len(input)-len(u.name)], u.bytes, true
+		}
+	}
+	return input, 0, false
+}
+
+// sameByteSymbol tells if the input ends with the same B of bytes or b of bits as the unit name does
+// before /s
+func sameByteSymbol(input, name string) bool {
+	if !strings.HasSuffix(name, "B/s") && !strings.HasSuffix(name, "b/s") {
+		return true
+	}
+	return input[len(input)-3] == name[len(name)-3]
+}
+
+func unitNames(units []unit) []string {
+	names := make([]string, len(units))
+	for idx, u := range units {
+		names[idx] = u.name
+	}
+	return names
+}
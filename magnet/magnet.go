@@ -0,0 +1,193 @@
+package magnet
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"ratio-spoof/bencode"
+	"strconv"
+	"strings"
+)
+
+const (
+	scheme        = "magnet:"
+	btihPrefix    = "urn:btih:"
+	minPieceSize  = 16 * 1024
+	maxPieceSize  = 16 * 1024 * 1024
+	maxPieceCount = 2000
+)
+
+// Link contains the information carried by a magnet uri
+type Link struct {
+	InfoHash    [20]byte
+	DisplayName string
+	Trackers    []string
+	// ExactLength is the xl parameter, 0 when the link does not have one
+	ExactLength int
+}
+
+// IsMagnet tells if the torrent path is a magnet uri
+func IsMagnet(path string) bool {
+	return strings.HasPrefix(strings.ToLower(path), scheme+"?")
+}
+
+// Parse decodes a magnet uri, the info hash can be written in hex or base32
+func Parse(uri string) (*Link, error) {
+	if !IsMagnet(uri) {
+		return nil, errors.New("magnet link must start with magnet:?")
+	}
+	params, err := url.ParseQuery(uri[len(scheme)+1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid magnet link: %w", err)
+	}
+
+	link := &Link{DisplayName: params.Get("dn")}
+	found := false
+	for _, xt := range params["xt"] {
+		if !strings.HasPrefix(strings.ToLower(xt), btihPrefix) {
+			continue
+		}
+		if link.InfoHash, err = decodeInfoHash(xt[len(btihPrefix):]); err != nil {
+			return nil, err
+		}
+		found = true
+		break
+	}
+	if !found {
+		return nil, errors.New("magnet link has no urn:btih info hash")
+	}
+
+	seen := make(map[string]bool)
+	for _, tr := range params["tr"] {
+		if tr != "" && !seen[tr] {
+			seen[tr] = true
+			link.Trackers = append(link.Trackers, tr)
+		}
+	}
+
+	if xl := params.Get("xl"); xl != "" {
+		link.ExactLength, err = strconv.Atoi(xl)
+		if err != nil || link.ExactLength <= 0 {
+			return nil, fmt.Errorf("invalid magnet link length %q", xl)
+		}
+	}
+	return link, nil
+}
+
+func decodeInfoHash(value string) ([20]byte, error) {
+	var infoHash [20]byte
+	var decoded []byte
+	var err error
+	switch len(value) {
+	case 40:
+		decoded, err = hex.DecodeString(value)
+	case 32:
+		decoded, err = base32.StdEncoding.DecodeString(strings.ToUpper(value))
+	default:
+		return infoHash, fmt.Errorf("info hash %q must be 40 hex or 32 base32 characters", value)
+	}
+	if err != nil {
+		return infoHash, fmt.Errorf("invalid info hash %q: %w", value, err)
+	}
+	copy(infoHash[:], decoded)
+	return infoHash, nil
+}
+
+// HexInfoHash is the info hash as written in hex magnet links and cached torrent names
+func (l *Link) HexInfoHash() string {
+	return hex.EncodeToString(l.InfoHash[:])
+}
+
+// TorrentInfo builds the torrent information of the link. A torrent with the same info hash found in
+// cacheDir is used when there is one, otherwise the size comes from the xl parameter and the piece
+// size is estimated. The trackers of the link take precedence over the ones of the cached torrent
+func (l *Link) TorrentInfo(cacheDir string) (*bencode.TorrentInfo, error) {
+	var torrentInfo *bencode.TorrentInfo
+	if cacheDir != "" {
+		cached, err := l.findCached(cacheDir)
+		if err != nil {
+			return nil, err
+		}
+		torrentInfo = cached
+	}
+
+	if torrentInfo == nil {
+		if l.ExactLength == 0 {
+			return nil, fmt.Errorf("the size of the magnet link torrent %s is unknown, add an xl parameter to the link or put its .torrent file in the magnet cache directory", l.HexInfoHash())
+		}
+		name := l.DisplayName
+		if name == "" {
+			name = l.HexInfoHash()
+		}
+		torrentInfo = &bencode.TorrentInfo{
+			Name:               name,
+			PieceSize:          estimatePieceSize(l.ExactLength),
+			TotalSize:          l.ExactLength,
+			InfoHashURLEncoded: bencode.URLEncodeInfoHash(l.InfoHash[:]),
+			InfoHash:           l.InfoHash,
+			Files:              []bencode.File{{Path: []string{name}, Length: l.ExactLength}},
+		}
+	}
+
+	if len(l.Trackers) > 0 {
+		torrentInfo.TrackerInfo = l.trackerInfo()
+	}
+	if torrentInfo.TrackerInfo == nil {
+		return nil, errors.New("magnet link has no tracker")
+	}
+	return torrentInfo, nil
+}
+
+// trackerInfo puts every tracker of the link in its own tier as it is done for magnet links
+func (l *Link) trackerInfo() *bencode.TrackerInfo {
+	info := &bencode.TrackerInfo{Main: l.Trackers[0], Urls: l.Trackers}
+	for _, tr := range l.Trackers {
+		info.Tiers = append(info.Tiers, []string{tr})
+	}
+	return info
+}
+
+// findCached looks for <infohash>.torrent in dir before parsing every other .torrent file in it
+func (l *Link) findCached(dir string) (*bencode.TorrentInfo, error) {
+	for _, name := range []string{l.HexInfoHash(), strings.ToUpper(l.HexInfoHash())} {
+		dat, err := os.ReadFile(filepath.Join(dir, name+".torrent"))
+		if err != nil {
+			continue
+		}
+		if torrentInfo, err := bencode.TorrentDictParse(dat); err == nil && torrentInfo.InfoHash == l.InfoHash {
+			return torrentInfo, torrentInfo.Validate()
+		}
+	}
+
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("magnet cache directory: %w", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.torrent"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		dat, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if torrentInfo, err := bencode.TorrentDictParse(dat); err == nil && torrentInfo.InfoHash == l.InfoHash {
+			return torrentInfo, torrentInfo.Validate()
+		}
+	}
+	return nil, nil
+}
+
+// estimatePieceSize picks the smallest power of two keeping the piece count under maxPieceCount, as
+// torrent creators do
+func estimatePieceSize(totalSize int) int {
+	pieceSize := minPieceSize
+	for pieceSize < maxPieceSize && totalSize/pieceSize > maxPieceCount {
+		pieceSize *= 2
+	}
+	return pieceSize
+}
@@ -0,0 +1,160 @@
+package magnet
+
+import (
+	"os"
+	"path/filepath"
+	"ratio-spoof/bencode"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testTorrent = "../bencode/torrent_files_test/debian-12.0.0-amd64-DVD-1.iso.torrent"
+
+func TestParse(T *testing.T) {
+	want := [20]byte{0x5c, 0x7b, 0x0a, 0x28, 0x3d, 0x2f, 0x4e, 0x1a, 0x9b, 0xb4, 0x6f, 0x84, 0x13, 0x7d, 0xbb, 0x96, 0x3a, 0x8d, 0x9f, 0x01}
+	data := []struct {
+		name string
+		uri  string
+		want Link
+	}{
+		{
+			name: "hex info hash",
+			uri:  "magnet:?xt=urn:btih:5c7b0a283d2f4e1a9bb46f84137dbb963a8d9f01&dn=Some+File.iso&tr=http%3A%2F%2Ftracker.example%2Fannounce&xl=1024",
+			want: Link{InfoHash: want, DisplayName: "Some File.iso", Trackers: []string{"http://tracker.example/announce"}, ExactLength: 1024},
+		},
+		{
+			name: "base32 info hash",
+			uri:  "magnet:?xt=urn:btih:LR5QUKB5F5HBVG5UN6CBG7N3SY5I3HYB",
+			want: Link{InfoHash: want},
+		},
+		{
+			name: "duplicated trackers are dropped and other hashes ignored",
+			uri:  "magnet:?xt=urn:btmh:1220abcd&xt=urn:btih:5C7B0A283D2F4E1A9BB46F84137DBB963A8D9F01&tr=http://a&tr=http://b&tr=http://a",
+			want: Link{InfoHash: want, Trackers: []string{"http://a", "http://b"}},
+		},
+	}
+	for _, td := range data {
+		T.Run(td.name, func(t *testing.T) {
+			got, err := Parse(td.uri)
+			if err != nil {
+				t.Fatalf("should not return error: %v", err)
+			}
+			if !reflect.DeepEqual(*got, td.want) {
+				t.Errorf("got: %+v want %+v", *got, td.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(T *testing.T) {
+	data := []struct {
+		uri  string
+		want string
+	}{
+		{"http://tracker.example", "magnet link must start with magnet:?"},
+		{"magnet:?dn=name", "magnet link has no urn:btih info hash"},
+		{"magnet:?xt=urn:btih:1234", "must be 40 hex or 32 base32 characters"},
+		{"magnet:?xt=urn:btih:zz7b0a283d2f4e1a9bb46f84137dbb963a8d9f01", "invalid info hash"},
+		{"magnet:?xt=urn:btih:5c7b0a283d2f4e1a9bb46f84137dbb963a8d9f01&xl=-1", `invalid magnet link length "-1"`},
+	}
+	for _, td := range data {
+		_, err := Parse(td.uri)
+		if err == nil || !strings.Contains(err.Error(), td.want) {
+			T.Errorf("%s: got: %v want %v", td.uri, err, td.want)
+		}
+	}
+}
+
+func TestTorrentInfo(T *testing.T) {
+	dat, _ := os.ReadFile(testTorrent)
+	cached, err := bencode.TorrentDictParse(dat)
+	if err != nil {
+		T.Fatal(err)
+	}
+	hexHash := cached.InfoHashHex()
+
+	T.Run("Size from xl", func(t *testing.T) {
+		link, _ := Parse("magnet:?xt=urn:btih:" + hexHash + "&dn=debian&tr=http://a&tr=http://b&xl=4000000000")
+		got, err := link.TorrentInfo("")
+		if err != nil {
+			t.Fatalf("should not return error: %v", err)
+		}
+		want := &bencode.TorrentInfo{
+			Name:               "debian",
+			PieceSize:          2 * 1024 * 1024,
+			TotalSize:          4000000000,
+			InfoHashURLEncoded: cached.InfoHashURLEncoded,
+			InfoHash:           cached.InfoHash,
+			Files:              []bencode.File{{Path: []string{"debian"}, Length: 4000000000}},
+			TrackerInfo:        &bencode.TrackerInfo{Main: "http://a", Urls: []string{"http://a", "http://b"}, Tiers: [][]string{{"http://a"}, {"http://b"}}},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got: %+v want %+v", got, want)
+		}
+	})
+
+	T.Run("Torrent found in the cache directory", func(t *testing.T) {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "renamed.torrent"), dat, 0o600)
+		link, _ := Parse("magnet:?xt=urn:btih:" + hexHash)
+		got, err := link.TorrentInfo(dir)
+		if err != nil {
+			t.Fatalf("should not return error: %v", err)
+		}
+		if !reflect.DeepEqual(got, cached) {
+			t.Errorf("got: %+v want %+v", got, cached)
+		}
+	})
+
+	T.Run("Link trackers replace the cached ones", func(t *testing.T) {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, hexHash+".torrent"), dat, 0o600)
+		link, _ := Parse("magnet:?xt=urn:btih:" + hexHash + "&tr=http://a")
+		got, _ := link.TorrentInfo(dir)
+		if got.TotalSize != cached.TotalSize || got.TrackerInfo.Main != "http://a" {
+			t.Errorf("got: %+v", got)
+		}
+	})
+
+	T.Run("Unknown size", func(t *testing.T) {
+		link, _ := Parse("magnet:?xt=urn:btih:5c7b0a283d2f4e1a9bb46f84137dbb963a8d9f01&tr=http://a")
+		_, err := link.TorrentInfo(t.TempDir())
+		if err == nil || !strings.Contains(err.Error(), "the size of the magnet link torrent 5c7b0a283d2f4e1a9bb46f84137dbb963a8d9f01 is unknown") {
+			t.Errorf("got: %v", err)
+		}
+	})
+
+	T.Run("Missing cache directory", func(t *testing.T) {
+		link, _ := Parse("magnet:?xt=urn:btih:5c7b0a283d2f4e1a9bb46f84137dbb963a8d9f01&xl=10")
+		_, err := link.TorrentInfo(filepath.Join(t.TempDir(), "missing"))
+		if err == nil || !strings.Contains(err.Error(), "magnet cache directory") {
+			t.Errorf("got: %v", err)
+		}
+	})
+
+	T.Run("No tracker", func(t *testing.T) {
+		link, _ := Parse("magnet:?xt=urn:btih:5c7b0a283d2f4e1a9bb46f84137dbb963a8d9f01&xl=10")
+		_, err := link.TorrentInfo("")
+		if err == nil || err.Error() != "magnet link has no tracker" {
+			t.Errorf("got: %v", err)
+		}
+	})
+}
+
+func TestEstimatePieceSize(T *testing.T) {
+	data := []struct {
+		size int
+		want int
+	}{
+		{0, 16 * 1024},
+		{10 * 1024 * 1024, 16 * 1024},
+		{700 * 1024 * 1024, 512 * 1024},
+		{100 * 1024 * 1024 * 1024, 16 * 1024 * 1024},
+	}
+	for _, td := range data {
+		if got := estimatePieceSize(td.size); got != td.want {
+			T.Errorf("%d: got: %v want %v", td.size, got, td.want)
+		}
+	}
+}
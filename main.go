@@ -1,27 +1,79 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"ratio-spoof/emulation"
 	"ratio-spoof/input"
 	"ratio-spoof/printer"
 	"ratio-spoof/ratiospoof"
+	"ratio-spoof/tracker"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	exitStopped = 0
+	// exitFailed is used when something other than the tracker ends the session, and by the commands
+	// when differences are found or the output can not be written
+	exitFailed = 1
+	// exitSetupError is used for usage errors and invalid arguments, torrents, profiles or records, as
+	// the flag package does for unknown flags
+	exitSetupError = 2
+	// exitTrackerRefused is used when the tracker refused the torrent, announcing again will not help
+	exitTrackerRefused = 3
+	// exitTrackerUnreachable is used when the retries ran out before reaching the tracker
+	exitTrackerUnreachable = 4
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			os.Exit(runReplay(os.Args[2:]))
+		case "info":
+			os.Exit(runInfo(os.Args[2:]))
+		case "clients":
+			os.Exit(runClients(os.Args[2:]))
+		}
+	}
+
 	//required
-	torrentPath := flag.String("t", "", "torrent path")
+	torrentPath := flag.String("t", "", "torrent path, url, magnet link or - for stdin")
 	download := flag.String("d", "100%:0kbps", "initial downloaded percentage and download speed (format: <percentage>:<speed>)")
 	upload := flag.String("u", "0%:0kbps", "initial uploaded percentage and upload speed (format: <percentage>:<speed>)")
 
 	//optional
-	client := flag.String("c", "qbit-5.0.4", "emulated client")
-	port := flag.Int("p", 8999, "a PORT")
+	client := flag.String("c", ratiospoof.DefaultClient, "emulated client code or path of a JSON profile")
+	profilesDir := flag.String("profiles", emulation.DefaultProfilesDir(), "directory searched for JSON profiles before the embedded ones")
+	port := flag.Int("p", ratiospoof.DefaultPort, "a PORT")
 	debug := flag.Bool("debug", false, "")
 	waitForLeechers := flag.Bool("wait-leechers", false, "wait for leechers instead of continuing with reduced speed")
+	dryRun := flag.Bool("dry-run", false, "log the announces instead of sending them to the tracker")
+	dryRunInterval := flag.Int("dry-run-interval", 10, "simulated tracker interval in seconds when using -dry-run")
+	dryRunPeers := flag.String("dry-run-peers", "10:10", "simulated swarm when using -dry-run (format: <seeders>:<leechers>)")
+	announceAll := flag.String("announce-all", "", "announce to every tracker tier or url concurrently (tiers or urls)")
+	httpTimeout := flag.Duration("timeout", 30*time.Second, "timeout of each tracker request")
+	proxy := flag.String("proxy", "", "http, https or socks5 proxy url used to reach the tracker")
+	caBundle := flag.String("ca-bundle", "", "PEM file with extra certificates trusted for https trackers")
+	insecure := flag.Bool("insecure", false, "skip the tls certificate verification of https trackers")
+	disableKeepAlives := flag.Bool("disable-keep-alives", false, "open a new connection for every tracker request")
+	maxIdleConns := flag.Int("max-idle-conns", 0, "maximum number of idle connections kept open, 0 means no limit")
+	idleConnTimeout := flag.Duration("idle-conn-timeout", 90*time.Second, "time an idle connection is kept open")
+	sourceInterface := flag.String("interface", "", "name or ip address of the local interface used to reach the tracker")
+	retryPolicy := flag.String("retry", "forever", "what to do when an announce fails: forever, fail-fast or a number of retries")
+	recordPath := flag.String("record", "", "record every tracker request and response to a file")
+	magnetCache := flag.String("magnet-cache", "", "directory searched for the .torrent file of a magnet link")
+	announceIP := flag.String("ip", "", "address or host name sent in the {ip} query placeholder, auto to detect it")
+	announceIPv4 := flag.String("ipv4", "", "address sent in the {ipv4} query placeholder, auto to detect it")
+	announceIPv6 := flag.String("ipv6", "", "address sent in the {ipv6} query placeholder, auto to detect it")
+	dualStack := flag.Bool("dual-stack", false, "announce to every tracker over both ipv4 and ipv6")
+	identitiesPath := flag.String("identities", "", "file keeping the peer ids and keys so a restarted session resumes with them")
 
 	flag.Usage = func() {
 		fmt.Printf("usage: %s -t <TORRENT_PATH> -d <INITIAL_DOWNLOADED>:<DOWNLOAD_SPEED> -u <INITIAL_UPLOADED>:<UPLOAD_SPEED>\n", os.Args[0])
@@ -30,16 +82,59 @@ optional arguments:
 	-h					show this help message and exit
 	-p [PORT]			change the port number, default: 8999
 	-c [CLIENT_CODE]	the client emulation, default: qbit-5.0.4
+	-profiles [DIR]		directory searched for JSON profiles before the embedded ones, default: <USER_CONFIG_DIR>/ratio-spoof/profiles
 	-wait-leechers		wait for leechers instead of uploading with normal speed
+	-dry-run		log the announces instead of sending them to the tracker
+	-dry-run-interval [SECONDS]	simulated tracker interval, default: 10
+	-dry-run-peers [SEEDERS]:[LEECHERS]	simulated swarm, default: 10:10
+	-record [FILE]		record every tracker request and response to a file
+	-announce-all [tiers|urls]	announce to every tracker tier or url concurrently instead of the first one that answers
+	-retry [forever|fail-fast|N]	retry failed announces forever, never or N times, default: forever
+	-magnet-cache [DIR]	directory searched for the .torrent file of a magnet link
+	-identities [FILE]	file keeping the peer ids and keys so a restarted session resumes with them
+
+http arguments:
+	-timeout [DURATION]		timeout of each tracker request, default: 30s
+	-proxy [URL]			http://, https:// or socks5:// proxy used to reach the tracker
+	-ca-bundle [FILE]		PEM file with extra certificates trusted for https trackers
+	-insecure			skip the tls certificate verification of https trackers
+	-disable-keep-alives		open a new connection for every tracker request
+	-max-idle-conns [NUMBER]	maximum number of idle connections kept open, default: no limit
+	-idle-conn-timeout [DURATION]	time an idle connection is kept open, default: 90s
+	-interface [NAME|IP]		local interface used to reach the tracker
+
+address arguments:
+	-ip [ADDRESS|HOST|auto]		address sent in the {ip} query placeholder
+	-ipv4 [ADDRESS|auto]		address sent in the {ipv4} query placeholder
+	-ipv6 [ADDRESS|auto]		address sent in the {ipv6} query placeholder
+	-dual-stack			announce to every tracker over both ipv4 and ipv6
 	  
 required arguments:
-	-t  <TORRENT_PATH>     
+	-t  <TORRENT_PATH|URL|MAGNET_LINK|->     
 	-d  <INITIAL_DOWNLOADED>:<DOWNLOAD_SPEED> 
 	-u  <INITIAL_UPLOADED>:<UPLOAD_SPEED> 
 	  
-<INITIAL_DOWNLOADED> and <INITIAL_UPLOADED> must be in %
-<DOWNLOAD_SPEED> and <UPLOAD_SPEED> must be in kbps or mbps
-[CLIENT_CODE] options: qbit-4.0.3, qbit-4.3.9, qbit-4.6.5, qbit-5.0.4
+<INITIAL_DOWNLOADED> and <INITIAL_UPLOADED> can be a percentage, a size (B, KiB, MiB, GiB, TiB, kB, MB, GB, TB) or a byte count
+<DOWNLOAD_SPEED> and <UPLOAD_SPEED> can be in B/s, KiB/s, MiB/s, GiB/s, kB/s, MB/s, GB/s, bit/s, kbit/s, Mbit/s, Gbit/s, b/s, kb/s, Mb/s or Gb/s, B is bytes and b bits
+kbps, mbps and gbps are kept for compatibility and mean KiB/s, MiB/s and GiB/s, not kilobits
+<TORRENT_PATH> can be an http(s) url downloaded with the http arguments or - to read the standard input
+auto addresses are the first public ones of the local interfaces, or of -interface, and are left out when there is none
+<MAGNET_LINK> needs an xl parameter or its .torrent file in the -magnet-cache directory
+[CLIENT_CODE] options: qbit-4.0.3, qbit-4.3.9, qbit-4.6.5, qbit-5.0.4, qbit-5.1.0, transmission-4.0.6, deluge-2.1.1, rtorrent-0.9.8, the codes of the -profiles directory or the path of a JSON profile
+
+commands:
+	replay [-base-url URL] [-real-time] <FILE>	compare a recorded session against the current code
+	info [-magnet-cache DIR] <TORRENT_PATH|URL|MAGNET_LINK|->	show the torrent metadata, files and trackers
+	clients [-profiles DIR]	list the embedded and user profiles with where they come from
+	clients import [-o FILE] <CAPTURE|->	write the profile of a captured announce request or HAR file
+	clients diff [-profiles DIR] <CLIENT_CODE> <CLIENT_CODE>	compare the generators, query and headers of two profiles
+
+exit codes:
+	0	stopped by an interrupt signal
+	1	stopped by an error that did not come from the tracker, or differences found by replay and clients diff
+	2	invalid usage, arguments, torrent file, profile or record
+	3	the tracker refused the torrent
+	4	the tracker could not be reached with the -retry policy
 `)
 	}
 
@@ -53,40 +148,99 @@ required arguments:
 	// Parse download and upload parameters
 	initialDownloaded, downloadSpeed, err := parseCombinedParameter(*download)
 	if err != nil {
-		log.Fatalf("Error parsing download parameter: %v", err)
+		log.Printf("Error parsing download parameter: %v", err)
+		os.Exit(exitSetupError)
 	}
 
 	initialUploaded, uploadSpeed, err := parseCombinedParameter(*upload)
 	if err != nil {
-		log.Fatalf("Error parsing upload parameter: %v", err)
+		log.Printf("Error parsing upload parameter: %v", err)
+		os.Exit(exitSetupError)
+	}
+
+	httpClient := tracker.ClientConfig{
+		Timeout:            *httpTimeout,
+		Proxy:              *proxy,
+		CABundle:           *caBundle,
+		InsecureSkipVerify: *insecure,
+		DisableKeepAlives:  *disableKeepAlives,
+		MaxIdleConns:       *maxIdleConns,
+		IdleConnTimeout:    *idleConnTimeout,
+		SourceInterface:    *sourceInterface,
 	}
 
 	r, err := ratiospoof.NewRatioSpoofState(
 		input.InputArgs{
+			AnnounceAll:       *announceAll,
+			AnnounceIP:        *announceIP,
+			AnnounceIPv4:      *announceIPv4,
+			AnnounceIPv6:      *announceIPv6,
+			DualStack:         *dualStack,
 			TorrentPath:       *torrentPath,
 			InitialDownloaded: initialDownloaded,
 			DownloadSpeed:     downloadSpeed,
+			HttpClient:        httpClient,
+			IdentitiesPath:    *identitiesPath,
 			InitialUploaded:   initialUploaded,
+			MagnetCacheDir:    *magnetCache,
 			UploadSpeed:       uploadSpeed,
 			Port:              *port,
+			ProfilesDir:       *profilesDir,
+			RecordPath:        *recordPath,
+			RetryPolicy:       *retryPolicy,
 			Debug:             *debug,
+			DryRun:            *dryRun,
+			DryRunInterval:    *dryRunInterval,
+			DryRunPeers:       *dryRunPeers,
 			Client:            *client,
 			WaitForLeechers:   *waitForLeechers,
 		})
 
 	if err != nil {
-		log.Fatalln(err)
+		log.Println(err)
+		os.Exit(exitSetupError)
+	}
+
+	if !*dryRun {
+		go printer.PrintState(r)
 	}
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		r.Stop()
+	}()
+	if err := r.Run(); err != nil {
+		log.Println(err)
+		os.Exit(runExitCode(err))
+	}
+	os.Exit(exitStopped)
+}
 
-	go printer.PrintState(r)
-	r.Run()
+// runExitCode tells a tracker refusing the torrent from retries running out, other errors did not come
+// from the tracker
+func runExitCode(err error) int {
+	var network *tracker.NetworkError
+	var decode *tracker.DecodeError
+	var failure *tracker.TrackerFailure
+	var status *tracker.HTTPStatusError
+	switch {
+	case errors.As(err, &failure), errors.As(err, &status):
+		if tracker.IsRetryable(err) {
+			return exitTrackerUnreachable
+		}
+		return exitTrackerRefused
+	case errors.As(err, &network), errors.As(err, &decode):
+		return exitTrackerUnreachable
+	}
+	return exitFailed
 }
 
 func parseCombinedParameter(param string) (string, string, error) {
 	parts := strings.Split(param, ":")
 	if len(parts) == 1 {
 		// If only speed is provided, use default percentage
-		if strings.HasSuffix(parts[0], "kbps") || strings.HasSuffix(parts[0], "mbps") {
+		if _, err := input.ParseSpeed(parts[0]); err == nil {
 			if strings.HasPrefix(param, "d") {
 				return "100%", parts[0], nil
 			}
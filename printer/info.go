@@ -0,0 +1,47 @@
+package printer
+
+import (
+	"fmt"
+	"io"
+	"ratio-spoof/bencode"
+	"strings"
+	"time"
+)
+
+// PrintTorrentInfo writes the metadata of the torrent, as shown by the info command
+func PrintTorrentInfo(w io.Writer, t *bencode.TorrentInfo) {
+	fmt.Fprintf(w, "Name:          %v\n", t.Name)
+	fmt.Fprintf(w, "Info hash:     %v\n", t.InfoHashHex())
+	fmt.Fprintf(w, "Size:          %v (%v bytes)\n", humanReadableSize(float64(t.TotalSize)), t.TotalSize)
+	fmt.Fprintf(w, "Pieces:        %v x %v\n", t.PieceCount, humanReadableSize(float64(t.PieceSize)))
+	fmt.Fprintf(w, "Private:       %v\n", t.Private)
+	if t.CreatedBy != "" {
+		fmt.Fprintf(w, "Created by:    %v\n", t.CreatedBy)
+	}
+	if !t.CreationDate.IsZero() {
+		fmt.Fprintf(w, "Creation date: %v\n", t.CreationDate.Format(time.RFC3339))
+	}
+	if t.Comment != "" {
+		fmt.Fprintf(w, "Comment:       %v\n", t.Comment)
+	}
+	if t.Source != "" {
+		fmt.Fprintf(w, "Source:        %v\n", t.Source)
+	}
+
+	if t.TrackerInfo != nil {
+		fmt.Fprintf(w, "Trackers:\n")
+		for idx, tier := range t.TrackerInfo.Tiers {
+			fmt.Fprintf(w, "\ttier %v: %v\n", idx+1, strings.Join(tier, ", "))
+		}
+	}
+	if len(t.WebSeeds) > 0 {
+		fmt.Fprintf(w, "Web seeds:\n")
+		for _, seed := range t.WebSeeds {
+			fmt.Fprintf(w, "\t%v\n", seed)
+		}
+	}
+	fmt.Fprintf(w, "Files:\n")
+	for _, f := range t.Files {
+		fmt.Fprintf(w, "\t%v (%v)\n", strings.Join(f.Path, "/"), humanReadableSize(float64(f.Length)))
+	}
+}
@@ -3,9 +3,11 @@ package printer
 import (
 	"fmt"
 	"ratio-spoof/ratiospoof"
+	"ratio-spoof/tracker"
 	"os"
 	"os/exec"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 
@@ -22,6 +24,9 @@ func PrintState(state *ratiospoof.RatioSpoof) {
 
 		if state.AnnounceCount == 1 {
 			println("Trying to connect to the tracker...")
+			if state.State == ratiospoof.StateRetrying {
+				fmt.Printf("Retry %v in %v: %v\n", state.Tracker.RetryAttempt, fmtDuration(time.Until(state.Tracker.EstimatedTimeToAnnounce)), state.Err)
+			}
 			time.Sleep(1 * time.Second)
 			continue
 		}
@@ -55,6 +60,10 @@ func PrintState(state *ratiospoof.RatioSpoof) {
 				state.Input.Port,
 				fmtDuration(seedTime))
 
+			if len(state.Trackers) > 1 {
+				printTrackers(state.Trackers)
+			}
+
 			for i := 0; i <= state.AnnounceHistory.Len()-2; i++ {
 				dequeItem := state.AnnounceHistory.At(i).(ratiospoof.AnnounceEntry)
 				fmt.Printf("#%v downloaded: %v(%.2f%%) | left: %v | uploaded: %v | announced\n", dequeItem.Count, humanReadableSize(float64(dequeItem.Downloaded)), dequeItem.PercentDownloaded, humanReadableSize(float64(dequeItem.Left)), humanReadableSize(float64(dequeItem.Uploaded)))
@@ -71,20 +80,76 @@ func PrintState(state *ratiospoof.RatioSpoof) {
 				retryStr)
 
 			// Always display the status message if there is one
-			if state.LastMessage != "" {
+			if state.LastMessage != "" || state.State == ratiospoof.StateRetrying {
 				fmt.Printf("\n%s\n", center("  STATUS  ", width-len("  STATUS  "), "#"))
-				fmt.Printf("\n%s\n", state.LastMessage)
+				if state.State == ratiospoof.StateRetrying {
+					fmt.Printf("\n[WARNING] Announce failed: %v\n", state.Err)
+				}
+				if state.LastMessage != "" {
+					fmt.Printf("\n%s\n", state.LastMessage)
+				}
 			}
 
 			if state.Input.Debug {
 				fmt.Printf("\n%s\n", center("  DEBUG  ", width-len("  DEBUG  "), "#"))
-				fmt.Printf("\n%s\n\n%s", state.Tracker.LastAnounceRequest, state.Tracker.LastTackerResponse)
+				fmt.Printf("\n%s\n\n%s\n", state.Tracker.LastAnounceRequest, state.Tracker.LastTackerResponse)
+				for _, s := range state.Trackers {
+					printHealth(s.Tracker.Health())
+				}
 			}
 			time.Sleep(1 * time.Second)
 		}
 	}
 }
 
+func printTrackers(trackers []*ratiospoof.TrackerSession) {
+	fmt.Printf("\tTrackers:\n")
+	for idx, s := range trackers {
+		url := s.Tracker.Tiers[0][0]
+		if s.Network != "" {
+			url += " (" + s.Network + ")"
+		}
+		var retryStr string
+		if s.Tracker.RetryAttempt > 0 {
+			retryStr = fmt.Sprintf(" (*Retry %v)", s.Tracker.RetryAttempt)
+		}
+		if s.Err != nil {
+			fmt.Printf("\t  #%v %v | stopped: %v\n", idx+1, url, s.Err)
+			continue
+		}
+		fmt.Printf("\t  #%v %v | seeders: %v | leechers: %v | next announce in: %v%v\n",
+			idx+1,
+			url,
+			s.Seeders,
+			s.Leechers,
+			fmtDuration(time.Until(s.Tracker.EstimatedTimeToAnnounce)),
+			retryStr)
+	}
+	fmt.Println()
+}
+
+func printHealth(health map[string]tracker.UrlHealth) {
+	urls := make([]string, 0, len(health))
+	for url := range health {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		fmt.Printf("\n%s\n", formatHealth(url, health[url], time.Now()))
+	}
+}
+
+func formatHealth(url string, h tracker.UrlHealth, now time.Time) string {
+	result := fmt.Sprintf("%v | ok: %v | failed: %v | latency: %v", url, h.Successes, h.Failures, h.LastLatency.Round(time.Millisecond))
+	if h.Skipped(now) {
+		result += fmt.Sprintf(" | skipped for: %v", fmtDuration(h.SkipUntil.Sub(now)))
+	}
+	if h.ConsecutiveFailures > 0 {
+		result += fmt.Sprintf(" | last error: %v", h.LastError)
+	}
+	return result
+}
+
 func terminalSize() int {
 	size, _ := ts.GetSize()
 	width := size.Col()
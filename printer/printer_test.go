@@ -1,8 +1,12 @@
 package printer
 
 import (
+	"bytes"
 	"fmt"
+	"ratio-spoof/bencode"
+	"ratio-spoof/tracker"
 	"testing"
+	"time"
 )
 
 func TestHumanReadableSize(T *testing.T) {
@@ -29,3 +33,62 @@ func TestHumanReadableSize(T *testing.T) {
 		})
 	}
 }
+
+func TestFormatHealth(T *testing.T) {
+	now := time.Now()
+	data := []struct {
+		name string
+		in   tracker.UrlHealth
+		out  string
+	}{
+		{
+			name: "healthy url",
+			in:   tracker.UrlHealth{Successes: 3, LastLatency: 120400 * time.Microsecond},
+			out:  "http://url | ok: 3 | failed: 0 | latency: 120ms",
+		},
+		{
+			name: "skipped url",
+			in:   tracker.UrlHealth{Failures: 3, ConsecutiveFailures: 3, LastError: "timeout", SkipUntil: now.Add(90 * time.Second)},
+			out:  "http://url | ok: 0 | failed: 3 | latency: 0s | skipped for: 1m30s | last error: timeout",
+		},
+	}
+	for _, td := range data {
+		T.Run(td.name, func(t *testing.T) {
+			got := formatHealth("http://url", td.in, now)
+			if got != td.out {
+				t.Errorf("got %q, want %q", got, td.out)
+			}
+		})
+	}
+}
+
+func TestPrintTorrentInfo(T *testing.T) {
+	info := &bencode.TorrentInfo{
+		Name:        "root",
+		PieceSize:   16384,
+		TotalSize:   30,
+		PieceCount:  1,
+		Private:     true,
+		Source:      "SRC",
+		TrackerInfo: &bencode.TrackerInfo{Tiers: [][]string{{"http://a", "http://b"}, {"http://c"}}},
+		Files:       []bencode.File{{Path: []string{"dir", "a.txt"}, Length: 10}, {Path: []string{"b.txt"}, Length: 20}},
+	}
+	var buf bytes.Buffer
+	PrintTorrentInfo(&buf, info)
+	want := `Name:          root
+Info hash:     0000000000000000000000000000000000000000
+Size:          30.00B (30 bytes)
+Pieces:        1 x 16.00KiB
+Private:       true
+Source:        SRC
+Trackers:
+	tier 1: http://a, http://b
+	tier 2: http://c
+Files:
+	dir/a.txt (10.00B)
+	b.txt (20.00B)
+`
+	if buf.String() != want {
+		T.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,64 @@
+package ratiospoof
+
+import (
+	"errors"
+	"ratio-spoof/bencode"
+	"ratio-spoof/emulation"
+	"sync"
+)
+
+// Manager runs the sessions of several torrents sharing one set of identities, so the peer ids and keys
+// declared per process are the same for every torrent
+type Manager struct {
+	Identities *emulation.Identities
+	Sessions   []*RatioSpoof
+	mu         sync.Mutex
+}
+
+// NewManager builds a manager handing out the given identities, in memory ones when nil
+func NewManager(identities *emulation.Identities) *Manager {
+	if identities == nil {
+		identities = emulation.NewIdentities()
+	}
+	return &Manager{Identities: identities}
+}
+
+// Add builds the session of a torrent, the options are the ones of New
+func (m *Manager) Add(torrent *bencode.TorrentInfo, opts ...Option) (*RatioSpoof, error) {
+	r, err := New(torrent, append(opts, WithIdentities(m.Identities))...)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Sessions = append(m.Sessions, r)
+	return r, nil
+}
+
+// Run runs every session until they are all stopped and returns the errors of the ones that failed
+func (m *Manager) Run() error {
+	m.mu.Lock()
+	sessions := append([]*RatioSpoof{}, m.Sessions...)
+	m.mu.Unlock()
+
+	errs := make([]error, len(sessions))
+	var wg sync.WaitGroup
+	for idx, r := range sessions {
+		wg.Add(1)
+		go func(idx int, r *RatioSpoof) {
+			defer wg.Done()
+			errs[idx] = r.Run()
+		}(idx, r)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Stop stops every session, Run returns once they all sent their stopped announces
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.Sessions {
+		r.Stop()
+	}
+}
@@ -0,0 +1,112 @@
+package ratiospoof
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"ratio-spoof/bencode"
+	"ratio-spoof/emulation"
+	"ratio-spoof/input"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestManager(t *testing.T) {
+	var mu sync.Mutex
+	peerIds := make(map[string]string)
+	keys := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		peerIds[r.URL.Query().Get("info_hash")] = r.URL.Query().Get("peer_id")
+		keys[r.URL.Query().Get("info_hash")] = r.URL.Query().Get("key")
+		mu.Unlock()
+		w.Write([]byte("d8:intervali60ee"))
+	}))
+	defer server.Close()
+
+	m := NewManager(nil)
+	for _, infoHash := range []string{"%aa", "%bb"} {
+		torrent := &bencode.TorrentInfo{
+			TotalSize:          4096,
+			PieceSize:          256,
+			InfoHashURLEncoded: infoHash,
+			InfoHash:           [20]byte{infoHash[1]},
+			TrackerInfo:        &bencode.TrackerInfo{Main: server.URL, Urls: []string{server.URL}},
+		}
+		if _, err := m.Add(torrent, WithEmulation("rtorrent-0.9.8")); err != nil {
+			t.Fatalf("should not return error: %v", err)
+		}
+	}
+
+	done := make(chan error)
+	go func() { done <- m.Run() }()
+	for _, r := range m.Sessions {
+		for started := true; started; {
+			time.Sleep(10 * time.Millisecond)
+			r.mu.Lock()
+			started = r.Trackers[0].Event == "started"
+			r.mu.Unlock()
+		}
+	}
+	m.Stop()
+	if err := <-done; err != nil {
+		t.Errorf("should not return error: %v", err)
+	}
+
+	if len(peerIds) != 2 || peerIds["\xaa"] != peerIds["\xbb"] {
+		t.Errorf("the process peer id should be shared, got %q", peerIds)
+	}
+	if keys["\xaa"] == keys["\xbb"] {
+		t.Errorf("each torrent should have its own key, got %q", keys)
+	}
+}
+
+func TestManagerStoppedLifecycle(t *testing.T) {
+	var mu sync.Mutex
+	peerIds := make(map[string][]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		event := r.URL.Query().Get("event")
+		peerIds[event] = append(peerIds[event], r.URL.Query().Get("peer_id"))
+		mu.Unlock()
+		w.Write([]byte("d8:intervali60ee"))
+	}))
+	defer server.Close()
+
+	identities := emulation.NewIdentities()
+	m := NewManager(identities)
+	torrent := &bencode.TorrentInfo{
+		TotalSize:          4096,
+		PieceSize:          256,
+		InfoHashURLEncoded: "%aa",
+		InfoHash:           [20]byte{0xaa},
+		TrackerInfo:        &bencode.TrackerInfo{Main: server.URL, Urls: []string{server.URL, server.URL + "/secondary"}},
+	}
+	r, err := m.Add(torrent, WithEmulation("transmission-4.0.6"), WithAnnounceAll(input.AnnounceAllUrls))
+	if err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- m.Run() }()
+	for started := true; started; {
+		time.Sleep(10 * time.Millisecond)
+		r.mu.Lock()
+		started = r.Trackers[0].Event == "started" || r.Trackers[1].Event == "started"
+		r.mu.Unlock()
+	}
+	m.Stop()
+	if err := <-done; err != nil {
+		t.Errorf("should not return error: %v", err)
+	}
+
+	peerId := peerIds["started"][0]
+	for _, event := range []string{"started", "stopped"} {
+		if got := peerIds[event]; len(got) != 2 || got[0] != peerId || got[1] != peerId {
+			t.Errorf("every %v announce should send the peer id %q, got %q", event, peerId, got)
+		}
+	}
+	if next := identities.Get(r.BitTorrentClient, torrent.InfoHashHex()); next.PeerId == peerId {
+		t.Errorf("the peer id should be generated again once the session is stopped, got %q", next.PeerId)
+	}
+}
@@ -0,0 +1,148 @@
+package ratiospoof
+
+import (
+	"fmt"
+	"ratio-spoof/bencode"
+	"ratio-spoof/emulation"
+	"ratio-spoof/input"
+	"ratio-spoof/tracker"
+)
+
+const (
+	// DefaultClient is the emulated client when WithEmulation is not given
+	DefaultClient = "qbit-5.0.4"
+	// DefaultPort is the announced port when WithPort is not given
+	DefaultPort = 8999
+)
+
+// Option configures a session built with New
+type Option func(*options)
+
+type options struct {
+	client      string
+	profilesDir string
+	identities  *emulation.Identities
+	input.InputParsed
+}
+
+// WithInitialDownloaded sets the bytes already downloaded, the whole torrent by default
+func WithInitialDownloaded(bytes int) Option {
+	return func(o *options) { o.InitialDownloaded = bytes }
+}
+
+// WithInitialUploaded sets the bytes already uploaded, 0 by default
+func WithInitialUploaded(bytes int) Option {
+	return func(o *options) { o.InitialUploaded = bytes }
+}
+
+// WithDownloadSpeed sets the download speed in bytes per second
+func WithDownloadSpeed(bytesPerSecond int) Option {
+	return func(o *options) { o.DownloadSpeed = bytesPerSecond }
+}
+
+// WithUploadSpeed sets the upload speed in bytes per second
+func WithUploadSpeed(bytesPerSecond int) Option {
+	return func(o *options) { o.UploadSpeed = bytesPerSecond }
+}
+
+// WithEmulation sets the code of the emulated client, such as qbit-4.6.5, or the path of a JSON profile
+func WithEmulation(code string) Option {
+	return func(o *options) { o.client = code }
+}
+
+// WithProfilesDir searches the emulation profiles in dir before the embedded ones
+func WithProfilesDir(dir string) Option {
+	return func(o *options) { o.profilesDir = dir }
+}
+
+// WithPort sets the announced port
+func WithPort(port int) Option {
+	return func(o *options) { o.Port = port }
+}
+
+// WithWaitForLeechers stops uploading while the tracker reports no leechers
+func WithWaitForLeechers() Option {
+	return func(o *options) { o.WaitForLeechers = true }
+}
+
+// WithHTTPClient configures the http client used to reach the trackers
+func WithHTTPClient(cfg tracker.ClientConfig) Option {
+	return func(o *options) { o.HttpClient = cfg }
+}
+
+// WithAnnounceAll announces to every tier (input.AnnounceAllTiers) or every url (input.AnnounceAllUrls)
+// of the torrent concurrently
+func WithAnnounceAll(mode string) Option {
+	return func(o *options) { o.AnnounceAll = mode }
+}
+
+// WithAnnounceAddresses sets the addresses sent in the {ip}, {ipv4} and {ipv6} query placeholders, empty
+// ones are left out
+func WithAnnounceAddresses(ip, ipv4, ipv6 string) Option {
+	return func(o *options) {
+		o.AnnounceIP = ip
+		o.AnnounceIPv4 = ipv4
+		o.AnnounceIPv6 = ipv6
+	}
+}
+
+// WithDualStack announces to every tracker over both ipv4 and ipv6
+func WithDualStack() Option {
+	return func(o *options) { o.DualStack = true }
+}
+
+// WithIdentities shares the peer ids and keys with other sessions, see emulation.LoadIdentities to resume
+// them from a file
+func WithIdentities(identities *emulation.Identities) Option {
+	return func(o *options) { o.identities = identities }
+}
+
+// WithMaxRetries sets how many times a failed announce is retried, a negative value retries forever
+// which is the default
+func WithMaxRetries(retries int) Option {
+	return func(o *options) { o.MaxRetries = retries }
+}
+
+// WithDryRun logs the announces instead of sending them, the simulated tracker answers every
+// interval seconds with the given swarm
+func WithDryRun(interval, seeders, leechers int) Option {
+	return func(o *options) {
+		o.DryRun = true
+		o.DryRunInterval = interval
+		o.DryRunSeeders = seeders
+		o.DryRunLeechers = leechers
+	}
+}
+
+// WithRecord records every tracker request and response to the file at path
+func WithRecord(path string) Option {
+	return func(o *options) { o.RecordPath = path }
+}
+
+// New builds a session announcing the torrent, by default it seeds the whole torrent without
+// uploading as DefaultClient on DefaultPort. Call Run to start announcing
+func New(torrent *bencode.TorrentInfo, opts ...Option) (*RatioSpoof, error) {
+	o := options{client: DefaultClient}
+	o.InitialDownloaded = torrent.TotalSize
+	o.Port = DefaultPort
+	o.MaxRetries = -1
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := o.Validate(torrent.TotalSize); err != nil {
+		return nil, err
+	}
+
+	client, err := emulation.LoadEmulation(o.client, o.profilesDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the emulated client %s: %w", o.client, err)
+	}
+	httpClient, err := tracker.NewHTTPClient(o.HttpClient)
+	if err != nil {
+		return nil, err
+	}
+	if o.identities == nil {
+		o.identities = emulation.NewIdentities()
+	}
+	return newRatioSpoof(torrent, &o.InputParsed, o.client, client, httpClient, o.identities)
+}
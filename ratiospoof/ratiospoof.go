@@ -1,18 +1,19 @@
+// Package ratiospoof announces a torrent to its trackers as an emulated client reporting made up
+// downloaded and uploaded amounts. Sessions are built with New and run until Stop is called
 package ratiospoof
 
 import (
-	"errors"
 	"fmt"
 	"ratio-spoof/bencode"
 	"ratio-spoof/emulation"
 	"ratio-spoof/input"
+	"ratio-spoof/record"
 	"ratio-spoof/tracker"
 	"log"
 	"math/rand"
+	"net/http"
 	"os"
-	"os/signal"
-	"strings"
-	"syscall"
+	"sync"
 	"time"
 
 	"github.com/gammazero/deque"
@@ -22,21 +23,60 @@ const (
 	maxAnnounceHistory = 10
 )
 
+// State is the lifecycle of a session
+type State string
+
+const (
+	// StateStarting is set until the first announce succeeds
+	StateStarting State = "starting"
+	StateRunning  State = "running"
+	// StateRetrying is set while a failed announce to the main tracker is retried
+	StateRetrying State = "retrying"
+	// StateErrored is set when the main tracker refused the torrent or the retries ran out
+	StateErrored State = "errored"
+	// StateStopped is set after a graceful exit
+	StateStopped State = "stopped"
+)
+
 type RatioSpoof struct {
 	TorrentInfo      *bencode.TorrentInfo
 	Input            *input.InputParsed
 	Tracker          *tracker.HttpTracker
+	Trackers         []*TrackerSession
 	BitTorrentClient *emulation.Emulation
 	AnnounceInterval int
 	NumWant          int
 	Seeders          int
 	Leechers         int
 	AnnounceCount    int
-	Status           string
 	AnnounceHistory  announceHistory
 	Print            bool
 	LastMessage      string
 	SeedStartTime    time.Time
+	Recorder         *record.Recorder
+	// Identities holds the peer ids and keys, shared with the other sessions of a Manager
+	Identities *emulation.Identities
+	State      State
+	// Err is the last announce error while retrying, or the one that stopped the session
+	Err      error
+	mu       sync.Mutex
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// TrackerSession holds the announce state of each tracker the torrent is announced to, the first one
+// drives the downloaded and uploaded amounts
+type TrackerSession struct {
+	Tracker          *tracker.HttpTracker
+	AnnounceInterval int
+	Seeders          int
+	Leechers         int
+	Event            string
+	// Network is tcp4 or tcp6 when announcing over both families, empty otherwise
+	Network string
+	// Err is the error that stopped the announces to the tracker
+	Err      error
+	recorder *record.Recorder
 }
 
 type AnnounceEntry struct {
@@ -45,51 +85,145 @@ type AnnounceEntry struct {
 	PercentDownloaded float32
 	Uploaded          int
 	Left              int
+	candidates        *record.Candidates
 }
 
 type announceHistory struct {
 	deque.Deque
 }
 
-func NewRatioSpoofState(input input.InputArgs) (*RatioSpoof, error) {
-	dat, err := os.ReadFile(input.TorrentPath)
+// NewRatioSpoofState builds a session from the command line arguments, see New to build one from Go
+func NewRatioSpoofState(args input.InputArgs) (*RatioSpoof, error) {
+	client, err := emulation.LoadEmulation(args.Client, args.ProfilesDir)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("Error building the emulated client %s: %w", args.Client, err)
 	}
 
-	client, err := emulation.NewEmulation(input.Client)
+	httpClient, err := tracker.NewHTTPClient(args.HttpClient)
 	if err != nil {
-		return nil, errors.New("Error building the emulated client with the code")
+		return nil, err
 	}
 
-	torrentInfo, err := bencode.TorrentDictParse(dat)
+	torrentInfo, err := args.Source().TorrentInfo(httpClient)
 	if err != nil {
-		return nil, errors.New("failed to parse the torrent file")
+		return nil, err
 	}
 
-	httpTracker, err := tracker.NewHttpTracker(torrentInfo)
+	inputParsed, err := args.ParseInput(torrentInfo)
 	if err != nil {
 		return nil, err
 	}
 
-	inputParsed, err := input.ParseInput(torrentInfo)
+	identities := emulation.NewIdentities()
+	if args.IdentitiesPath != "" {
+		if identities, err = emulation.LoadIdentities(args.IdentitiesPath); err != nil {
+			return nil, err
+		}
+	}
+	return newRatioSpoof(torrentInfo, inputParsed, args.Client, client, httpClient, identities)
+}
+
+// newRatioSpoof builds the session shared by the command line and the library once the input is
+// parsed
+func newRatioSpoof(torrentInfo *bencode.TorrentInfo, inputParsed *input.InputParsed, clientCode string, client *emulation.Emulation, httpClient *http.Client, identities *emulation.Identities) (*RatioSpoof, error) {
+	httpTracker, err := tracker.NewHttpTracker(torrentInfo)
 	if err != nil {
 		return nil, err
 	}
-	
+	httpTracker.Client = httpClient
+
+	if inputParsed.DryRun {
+		httpTracker.DryRun = &tracker.DryRunConfig{
+			Interval: inputParsed.DryRunInterval,
+			Seeders:  inputParsed.DryRunSeeders,
+			Leechers: inputParsed.DryRunLeechers,
+			Logger:   log.New(os.Stdout, "[dry-run] ", log.LstdFlags),
+		}
+	}
+
+	var recorder *record.Recorder
+	if inputParsed.RecordPath != "" {
+		// profiles loaded from a file are recorded by path so the session can be replayed anywhere
+		if client.Origin != emulation.EmbeddedOrigin {
+			clientCode = client.Origin
+		}
+		identity := identities.Get(client, torrentInfo.InfoHashHex())
+		recorder, err = record.Create(inputParsed.RecordPath, record.Session{
+			Client:    clientCode,
+			InfoHash:  torrentInfo.InfoHashURLEncoded,
+			PieceSize: torrentInfo.PieceSize,
+			Port:      inputParsed.Port,
+			PeerId:    identity.PeerId,
+			Key:       identity.Key,
+			IP:        inputParsed.AnnounceIP,
+			IPv4:      inputParsed.AnnounceIPv4,
+			IPv6:      inputParsed.AnnounceIPv6,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	trackers := []*tracker.HttpTracker{httpTracker}
+	if inputParsed.AnnounceAll != "" {
+		trackers = httpTracker.Split(inputParsed.AnnounceAll == input.AnnounceAllUrls)
+	}
+	sessions := make([]*TrackerSession, 0, len(trackers))
+	for _, t := range trackers {
+		sessions = append(sessions, &TrackerSession{Tracker: t, Event: "started"})
+	}
+	if inputParsed.DualStack {
+		sessions, err = dualStackSessions(sessions, inputParsed.HttpClient)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range sessions {
+		if recorder != nil {
+			s.recorder = recorder.Fork()
+			s.Tracker.Recorder = s.recorder
+		}
+	}
+
 	return &RatioSpoof{
 		BitTorrentClient: client,
 		TorrentInfo:      torrentInfo,
-		Tracker:          httpTracker,
+		Tracker:          sessions[0].Tracker,
+		Trackers:         sessions,
 		Input:            inputParsed,
 		NumWant:          200,
-		Status:           "started",
+		State:            StateStarting,
 		Print:            true,
 		LastMessage:      "",
 		SeedStartTime:    time.Now(),
+		Recorder:         recorder,
+		Identities:       identities,
+		stop:             make(chan struct{}),
 	}, nil
 }
 
+// dualStackSessions replaces every session with one announcing over ipv4 and one over ipv6, as dual-stack
+// clients do, the ipv4 session of the first tracker stays the main one
+func dualStackSessions(sessions []*TrackerSession, cfg tracker.ClientConfig) ([]*TrackerSession, error) {
+	networks := []string{"tcp4", "tcp6"}
+	clients := make([]*http.Client, len(networks))
+	for idx, network := range networks {
+		cfg.Network = network
+		client, err := tracker.NewHTTPClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		clients[idx] = client
+	}
+	result := make([]*TrackerSession, 0, len(sessions)*len(networks))
+	for _, s := range sessions {
+		for idx, network := range networks {
+			result = append(result, &TrackerSession{Tracker: s.Tracker.WithClient(clients[idx]), Event: s.Event, Network: network})
+		}
+	}
+	return result, nil
+}
+
 func (a *announceHistory) pushValueHistory(value AnnounceEntry) {
 	if a.Len() >= maxAnnounceHistory {
 		a.PopFront()
@@ -99,83 +233,294 @@ func (a *announceHistory) pushValueHistory(value AnnounceEntry) {
 
 func (r *RatioSpoof) gracefullyExit() {
 	fmt.Printf("\nGracefully exiting...\n")
-	r.Status = "stopped"
-	r.NumWant = 0
-	r.fireAnnounce(false)
+	var stopping []*TrackerSession
+	r.mu.Lock()
+	for _, s := range r.Trackers {
+		// a tracker that refused the torrent or was never reached has nothing to stop
+		if s.Err != nil || s.Event == "started" {
+			continue
+		}
+		s.Event = "stopped"
+		stopping = append(stopping, s)
+	}
+	r.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, s := range stopping {
+		wg.Add(1)
+		go func(s *TrackerSession) {
+			defer wg.Done()
+			r.fireAnnounce(s, false)
+		}(s)
+	}
+	wg.Wait()
+	// once for the whole session, the trackers and address families share the identity
+	if len(stopping) > 0 {
+		r.Identities.Stopped(r.BitTorrentClient, r.TorrentInfo.InfoHashHex())
+	}
+	r.closeRecorder()
+	r.saveIdentities()
 	fmt.Printf("Gracefully exited successfully.\n")
+}
 
+func (r *RatioSpoof) saveIdentities() {
+	if err := r.Identities.Save(); err != nil {
+		fmt.Printf("Failed to write the identities file: %v\n", err)
+	}
 }
 
-func (r *RatioSpoof) Run() {
-	sigCh := make(chan os.Signal)
+func (r *RatioSpoof) closeRecorder() {
+	if r.Recorder != nil {
+		if err := r.Recorder.Close(); err != nil {
+			fmt.Printf("Failed to write the record file: %v\n", err)
+		}
+	}
+}
 
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-	r.firstAnnounce()
+// Run announces until Stop is called or the main tracker can not be announced to according to the retry
+// policy, in which case the error is returned. Every announce loop is over when the stopped announces are sent
+func (r *RatioSpoof) Run() error {
+	if r.stop == nil {
+		r.stop = make(chan struct{})
+	}
+	errCh := make(chan error, 1)
+	var loops sync.WaitGroup
+	loops.Add(1)
 	go func() {
-		for {
-			r.generateNextAnnounce()
-			time.Sleep(time.Duration(r.AnnounceInterval) * time.Second)
-			r.fireAnnounce(true)
-		}
+		defer loops.Done()
+		errCh <- r.announceMain(&loops)
 	}()
-	<-sigCh
+
+	var err error
+	select {
+	case <-r.stop:
+	case err = <-errCh:
+	}
+	r.Stop()
+	loops.Wait()
+
 	r.Print = false
+	if err != nil {
+		r.setState(StateErrored, err)
+		r.gracefullyExit()
+		return err
+	}
 	r.gracefullyExit()
+	r.setState(StateStopped, nil)
+	return nil
+}
+
+// announceMain announces to the main tracker and starts the loops of the secondary ones, it returns nil
+// once the session is stopped
+func (r *RatioSpoof) announceMain(loops *sync.WaitGroup) error {
+	if err := r.firstAnnounce(); err != nil {
+		return r.unlessStopped(err)
+	}
+	for _, s := range r.Trackers[1:] {
+		loops.Add(1)
+		go func(s *TrackerSession) {
+			defer loops.Done()
+			r.announceLoop(s)
+		}(s)
+	}
+	for {
+		r.generateNextAnnounce()
+		r.mu.Lock()
+		interval := r.AnnounceInterval
+		r.mu.Unlock()
+		if !r.wait(time.Duration(interval) * time.Second) {
+			return nil
+		}
+		if err := r.fireAnnounce(r.Trackers[0], true); err != nil {
+			return r.unlessStopped(err)
+		}
+	}
+}
+
+// wait sleeps for the duration and tells false when the session is stopped meanwhile
+func (r *RatioSpoof) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.stop:
+		return false
+	}
+}
+
+// unlessStopped drops the error of an announce whose retries were cut short by Stop
+func (r *RatioSpoof) unlessStopped(err error) error {
+	select {
+	case <-r.stop:
+		return nil
+	default:
+		return err
+	}
+}
+
+// Stop ends the announce loops and makes Run send the stopped announces and return
+func (r *RatioSpoof) Stop() {
+	if r.stop == nil {
+		return
+	}
+	r.stopOnce.Do(func() { close(r.stop) })
+}
+
+func (r *RatioSpoof) state() State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.State
+}
+
+func (r *RatioSpoof) setState(state State, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.State = state
+	r.Err = err
+}
+
+func (r *RatioSpoof) firstAnnounce() error {
+	r.addAnnounce(r.Input.InitialDownloaded, r.Input.InitialUploaded, calculateBytesLeft(r.Input.InitialDownloaded, r.TorrentInfo.TotalSize), (float32(r.Input.InitialDownloaded)/float32(r.TorrentInfo.TotalSize))*100, nil)
+	if err := r.fireAnnounce(r.Trackers[0], true); err != nil {
+		return err
+	}
+	// saved right away so a killed session still resumes with the same identity
+	r.saveIdentities()
+	return nil
 }
 
-func (r *RatioSpoof) firstAnnounce() {
-	r.addAnnounce(r.Input.InitialDownloaded, r.Input.InitialUploaded, calculateBytesLeft(r.Input.InitialDownloaded, r.TorrentInfo.TotalSize), (float32(r.Input.InitialDownloaded)/float32(r.TorrentInfo.TotalSize))*100)
-	r.fireAnnounce(false)
+// announceLoop keeps announcing the latest amounts to a secondary tracker using its own interval,
+// until the tracker refuses the torrent or the session is stopped
+func (r *RatioSpoof) announceLoop(s *TrackerSession) {
+	for {
+		if err := r.fireAnnounce(s, true); err != nil {
+			return
+		}
+		r.mu.Lock()
+		interval := s.AnnounceInterval
+		r.mu.Unlock()
+		if !r.wait(time.Duration(interval) * time.Second) {
+			return
+		}
+	}
 }
 
-func (r *RatioSpoof) updateSeedersAndLeechers(resp tracker.TrackerResponse) {
-	r.Seeders = resp.Seeders
-	r.Leechers = resp.Leechers
+// updateSeedersAndLeechers keeps the highest counts informed by the trackers, as they usually share
+// most of the swarm
+func (r *RatioSpoof) updateSeedersAndLeechers() {
+	r.Seeders, r.Leechers = 0, 0
+	for _, s := range r.Trackers {
+		if s.Seeders > r.Seeders {
+			r.Seeders = s.Seeders
+		}
+		if s.Leechers > r.Leechers {
+			r.Leechers = s.Leechers
+		}
+	}
 }
 
-func (r *RatioSpoof) addAnnounce(currentDownloaded, currentUploaded, currentLeft int, percentDownloaded float32) {
+func (r *RatioSpoof) addAnnounce(currentDownloaded, currentUploaded, currentLeft int, percentDownloaded float32, candidates *record.Candidates) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.AnnounceCount++
-	r.AnnounceHistory.pushValueHistory(AnnounceEntry{Count: r.AnnounceCount, Downloaded: currentDownloaded, Uploaded: currentUploaded, Left: currentLeft, PercentDownloaded: percentDownloaded})
+	r.AnnounceHistory.pushValueHistory(AnnounceEntry{Count: r.AnnounceCount, Downloaded: currentDownloaded, Uploaded: currentUploaded, Left: currentLeft, PercentDownloaded: percentDownloaded, candidates: candidates})
 }
 
-func (r *RatioSpoof) fireAnnounce(retry bool) error {
+func (r *RatioSpoof) fireAnnounce(s *TrackerSession, retry bool) error {
+	r.mu.Lock()
 	lastAnnounce := r.AnnounceHistory.Back().(AnnounceEntry)
-	replacer := strings.NewReplacer("{infohash}", r.TorrentInfo.InfoHashURLEncoded,
-		"{port}", fmt.Sprint(r.Input.Port),
-		"{peerid}", r.BitTorrentClient.PeerId(),
-		"{uploaded}", fmt.Sprint(lastAnnounce.Uploaded),
-		"{downloaded}", fmt.Sprint(lastAnnounce.Downloaded),
-		"{left}", fmt.Sprint(lastAnnounce.Left),
-		"{key}", r.BitTorrentClient.Key(),
-		"{event}", r.Status,
-		"{numwant}", fmt.Sprint(r.NumWant))
-	query := replacer.Replace(r.BitTorrentClient.Query)
-	trackerResp, err := r.Tracker.Announce(query, r.BitTorrentClient.Headers, retry)
+	event := s.Event
+	r.mu.Unlock()
+	identity := r.Identities.Get(r.BitTorrentClient, r.TorrentInfo.InfoHashHex())
+	values := r.BitTorrentClient.ApplyEvent(emulation.AnnounceValues{
+		InfoHash:   r.TorrentInfo.InfoHashURLEncoded,
+		PeerId:     identity.PeerId,
+		Key:        identity.Key,
+		Port:       r.Input.Port,
+		Uploaded:   lastAnnounce.Uploaded,
+		Downloaded: lastAnnounce.Downloaded,
+		Left:       lastAnnounce.Left,
+		Event:      event,
+		NumWant:    r.NumWant,
+		IP:         r.Input.AnnounceIP,
+		IPv4:       r.Input.AnnounceIPv4,
+		IPv6:       r.Input.AnnounceIPv6,
+	})
+	query := r.BitTorrentClient.BuildQuery(values)
+	if s.recorder != nil {
+		s.recorder.SetAnnounce(record.Announce{
+			Downloaded: lastAnnounce.Downloaded,
+			Uploaded:   lastAnnounce.Uploaded,
+			Left:       lastAnnounce.Left,
+			Event:      event,
+			NumWant:    values.NumWant,
+			Candidates: lastAnnounce.candidates,
+		})
+	}
+	trackerResp, err := s.Tracker.Announce(query, r.BitTorrentClient.Headers, r.retryPolicy(s, retry))
 	if err != nil {
-		log.Fatalf("failed to reach the tracker:\n%s ", err.Error())
+		r.mu.Lock()
+		s.Err = err
+		r.mu.Unlock()
+		return err
+	}
+	if state := r.state(); s == r.Trackers[0] && (state == StateStarting || state == StateRetrying) {
+		r.setState(StateRunning, nil)
 	}
 
 	if trackerResp != nil {
-		r.updateSeedersAndLeechers(*trackerResp)
-		r.AnnounceInterval = trackerResp.Interval
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		s.Seeders = trackerResp.Seeders
+		s.Leechers = trackerResp.Leechers
+		s.AnnounceInterval = trackerResp.Interval
+		// a completed event set while announcing must still be sent on the next one
+		if s.Event == event && event != "stopped" {
+			s.Event = ""
+		}
+		r.updateSeedersAndLeechers()
+		if s == r.Trackers[0] {
+			r.AnnounceInterval = s.AnnounceInterval
+		}
 	}
 	return nil
 }
 
+// retryPolicy applies the configured number of retries, the main tracker retries move the session to StateRetrying
+func (r *RatioSpoof) retryPolicy(s *TrackerSession, retry bool) tracker.RetryPolicy {
+	if !retry {
+		return tracker.NoRetry
+	}
+	return tracker.RetryPolicy{
+		MaxRetries: r.Input.MaxRetries,
+		Cancel:     r.stop,
+		OnRetry: func(attempt int, err error, delay time.Duration) {
+			if s == r.Trackers[0] {
+				r.setState(StateRetrying, err)
+			}
+		},
+	}
+}
+
 func (r *RatioSpoof) generateNextAnnounce() {
+	// the secondary trackers update the interval and peers concurrently
+	r.mu.Lock()
 	lastAnnounce := r.AnnounceHistory.Back().(AnnounceEntry)
+	interval := r.AnnounceInterval
+	leechers := r.Leechers
+	r.mu.Unlock()
 	currentDownloaded := lastAnnounce.Downloaded
 	var downloadCandidate int
 
 	if currentDownloaded < r.TorrentInfo.TotalSize {
 		randomPiecesDownload := rand.Intn(10-1) + 1
-		downloadCandidate = calculateNextTotalSizeByte(r.Input.DownloadSpeed, currentDownloaded, r.TorrentInfo.PieceSize, r.AnnounceInterval, r.TorrentInfo.TotalSize, randomPiecesDownload)
+		downloadCandidate = calculateNextTotalSizeByte(r.Input.DownloadSpeed, currentDownloaded, r.TorrentInfo.PieceSize, interval, r.TorrentInfo.TotalSize, randomPiecesDownload)
 	} else {
 		downloadCandidate = r.TorrentInfo.TotalSize
 	}
 	
 	// Calculate base upload amount
-	baseUpload := r.Input.UploadSpeed * r.AnnounceInterval
+	baseUpload := r.Input.UploadSpeed * interval
 	
 	// Calculate upload fluctuation based on multiple factors
 	var fluctuation float64
@@ -185,16 +530,18 @@ func (r *RatioSpoof) generateNextAnnounce() {
 	
 	// Adjust based on number of leechers (more leechers = more upload opportunity)
 	leecherFactor := 1.0
-	if r.Leechers > 0 {
+	if leechers > 0 {
 		// More leechers means more potential upload, but with diminishing returns
-		leecherFactor = 1.0 + (float64(r.Leechers) / 100.0)
+		leecherFactor = 1.0 + (float64(leechers) / 100.0)
 		if leecherFactor > 1.5 {
 			leecherFactor = 1.5 // Cap the leecher bonus
 		}
 	} else if r.Input.WaitForLeechers {
 		// If waiting for leechers, set upload to 0 and print warning
 		leecherFactor = 0.0
+		r.mu.Lock()
 		r.LastMessage = "[WARNING] No leechers detected. Waiting for leechers before continuing upload..."
+		r.mu.Unlock()
 	}
 	
 	// Combine all factors
@@ -207,15 +554,18 @@ func (r *RatioSpoof) generateNextAnnounce() {
 
 	d, u, l := r.BitTorrentClient.Round(downloadCandidate, uploadCandidate, leftCandidate, r.TorrentInfo.PieceSize)
 
-	// Check if we just completed the download
+	// Check if we just completed the download, every tracker is told on its next announce
 	if d == r.TorrentInfo.TotalSize && lastAnnounce.Downloaded < r.TorrentInfo.TotalSize {
-		r.Status = "completed"
-	} else if r.Status == "started" || r.Status == "completed" {
-		// After started/completed, use empty event for regular updates
-		r.Status = ""
+		r.mu.Lock()
+		for _, s := range r.Trackers {
+			if s.Event == "" {
+				s.Event = "completed"
+			}
+		}
+		r.mu.Unlock()
 	}
 
-	r.addAnnounce(d, u, l, (float32(d)/float32(r.TorrentInfo.TotalSize))*100)
+	r.addAnnounce(d, u, l, (float32(d)/float32(r.TorrentInfo.TotalSize))*100, &record.Candidates{Downloaded: downloadCandidate, Uploaded: uploadCandidate, Left: leftCandidate})
 }
 
 func calculateNextTotalSizeByte(speedBytePerSecond, currentByte, pieceSizeByte, seconds, limitTotalBytes, randomPieces int) int {
@@ -1,7 +1,21 @@
 package ratiospoof
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"ratio-spoof/bencode"
+	"ratio-spoof/emulation"
+	"ratio-spoof/input"
+	"ratio-spoof/tracker"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestCalculateNextTotalSizeByte(t *testing.T) {
@@ -13,3 +27,355 @@ func TestCalculateNextTotalSizeByte(t *testing.T) {
 		t.Errorf("\ngot : %v\nwant: %v", got, want)
 	}
 }
+
+func TestUpdateSeedersAndLeechers(t *testing.T) {
+	r := &RatioSpoof{Trackers: []*TrackerSession{{Seeders: 10, Leechers: 1}, {Seeders: 4, Leechers: 7}}}
+	r.updateSeedersAndLeechers()
+
+	if r.Seeders != 10 || r.Leechers != 7 {
+		t.Errorf("got %v:%v want %v:%v", r.Seeders, r.Leechers, 10, 7)
+	}
+}
+
+func TestFireAnnounceAllTrackers(t *testing.T) {
+	client, _ := emulation.NewEmulation("qbit-5.0.4")
+	dryRun := func(interval, seeders int) *tracker.HttpTracker {
+		return &tracker.HttpTracker{Tiers: [][]string{{"http://url"}},
+			DryRun: &tracker.DryRunConfig{Interval: interval, Seeders: seeders, Logger: log.New(io.Discard, "", 0)}}
+	}
+	r := &RatioSpoof{
+		BitTorrentClient: client,
+		TorrentInfo:      &bencode.TorrentInfo{TotalSize: 1024, PieceSize: 256},
+		Input:            &input.InputParsed{Port: 8999},
+		Trackers:         []*TrackerSession{{Tracker: dryRun(60, 3), Event: "started"}, {Tracker: dryRun(120, 5), Event: "started"}},
+	}
+	r.addAnnounce(0, 0, 1024, 0, nil)
+
+	r.fireAnnounce(r.Trackers[1], false)
+	if r.Trackers[1].Event != "" || r.Trackers[0].Event != "started" {
+		t.Errorf("only the announced tracker should clear its event, got %q and %q", r.Trackers[0].Event, r.Trackers[1].Event)
+	}
+	if r.AnnounceInterval != 0 || r.Trackers[1].AnnounceInterval != 120 {
+		t.Errorf("secondary trackers should keep their own interval, got %v and %v", r.AnnounceInterval, r.Trackers[1].AnnounceInterval)
+	}
+
+	r.fireAnnounce(r.Trackers[0], false)
+	if r.AnnounceInterval != 60 || r.Seeders != 5 {
+		t.Errorf("got interval %v seeders %v want %v %v", r.AnnounceInterval, r.Seeders, 60, 5)
+	}
+}
+
+func TestRunStopsOnTrackerRefusal(t *testing.T) {
+	var events []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events = append(events, r.URL.Query().Get("event"))
+		w.Write([]byte("d14:failure reason20:Unregistered torrente"))
+	}))
+	defer server.Close()
+
+	client, _ := emulation.NewEmulation("qbit-5.0.4")
+	r := &RatioSpoof{
+		BitTorrentClient: client,
+		TorrentInfo:      &bencode.TorrentInfo{TotalSize: 1024, PieceSize: 256},
+		Input:            &input.InputParsed{Port: 8999, MaxRetries: -1},
+		Trackers:         []*TrackerSession{{Tracker: &tracker.HttpTracker{Tiers: [][]string{{server.URL}}}, Event: "started"}},
+		State:            StateStarting,
+	}
+
+	err := r.Run()
+	var failure *tracker.TrackerFailure
+	if !errors.As(err, &failure) {
+		t.Fatalf("got: %v want a tracker failure", err)
+	}
+	if r.State != StateErrored || r.Err != err {
+		t.Errorf("got state %v error %v want %v %v", r.State, r.Err, StateErrored, err)
+	}
+	if !reflect.DeepEqual(events, []string{"started"}) {
+		t.Errorf("a refused torrent should not be stopped, got events %v", events)
+	}
+}
+
+func TestNew(t *testing.T) {
+	torrent := &bencode.TorrentInfo{
+		TotalSize:          4096,
+		PieceSize:          256,
+		InfoHashURLEncoded: "%b1h",
+		TrackerInfo:        &bencode.TrackerInfo{Main: "http://a", Urls: []string{"http://a"}, Tiers: [][]string{{"http://a"}}},
+	}
+
+	t.Run("Defaults", func(t *testing.T) {
+		r, err := New(torrent)
+		if err != nil {
+			t.Fatalf("should not return error: %v", err)
+		}
+		want := input.InputParsed{InitialDownloaded: 4096, Port: DefaultPort, MaxRetries: -1}
+		if !reflect.DeepEqual(*r.Input, want) {
+			t.Errorf("got: %+v want %+v", *r.Input, want)
+		}
+		if r.BitTorrentClient.Name != "qBittorrent v5.0.4" || r.State != StateStarting {
+			t.Errorf("got client %v state %v", r.BitTorrentClient.Name, r.State)
+		}
+	})
+
+	t.Run("Options", func(t *testing.T) {
+		r, err := New(torrent,
+			WithInitialDownloaded(1024),
+			WithInitialUploaded(2048),
+			WithDownloadSpeed(100),
+			WithUploadSpeed(200),
+			WithEmulation("qbit-4.6.5"),
+			WithPort(6881),
+			WithWaitForLeechers(),
+			WithMaxRetries(0),
+		)
+		if err != nil {
+			t.Fatalf("should not return error: %v", err)
+		}
+		want := input.InputParsed{InitialDownloaded: 1024, InitialUploaded: 2048, DownloadSpeed: 100, UploadSpeed: 200, Port: 6881, WaitForLeechers: true}
+		if !reflect.DeepEqual(*r.Input, want) {
+			t.Errorf("got: %+v want %+v", *r.Input, want)
+		}
+		if r.BitTorrentClient.Name != "qBittorrent v4.6.5" {
+			t.Errorf("got client %v", r.BitTorrentClient.Name)
+		}
+	})
+
+	t.Run("Dual stack", func(t *testing.T) {
+		var ipv6 string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ipv6 = r.URL.Query().Get("ipv6")
+			w.Write([]byte("d8:intervali60ee"))
+		}))
+		defer server.Close()
+		torrent := &bencode.TorrentInfo{TotalSize: 4096, PieceSize: 256, TrackerInfo: &bencode.TrackerInfo{Main: server.URL, Urls: []string{server.URL}}}
+
+		r, err := New(torrent, WithDualStack(), WithAnnounceAddresses("", "203.0.113.7", "2001:db8::1"))
+		if err != nil {
+			t.Fatalf("should not return error: %v", err)
+		}
+		if len(r.Trackers) != 2 || r.Trackers[0].Network != "tcp4" || r.Trackers[1].Network != "tcp6" {
+			t.Fatalf("got sessions %+v", r.Trackers)
+		}
+		if r.Trackers[0].Tracker.Client == r.Trackers[1].Tracker.Client || r.Tracker != r.Trackers[0].Tracker {
+			t.Errorf("each family should have its own client and the ipv4 session should be the main one")
+		}
+
+		r.BitTorrentClient.Query += "&ipv6={ipv6?}"
+		r.addAnnounce(0, 0, 4096, 0, nil)
+		if err := r.fireAnnounce(r.Trackers[0], false); err != nil {
+			t.Fatalf("should not return error: %v", err)
+		}
+		if ipv6 != "2001:db8::1" {
+			t.Errorf("got ipv6 %q want %q", ipv6, "2001:db8::1")
+		}
+	})
+
+	t.Run("Invalid options", func(t *testing.T) {
+		data := []struct {
+			opt  Option
+			want string
+		}{
+			{WithInitialDownloaded(4097), "initial downloaded can not be higher than the torrent size"},
+			{WithUploadSpeed(-1), "speed can not be negative"},
+			{WithPort(0), "port number must be between 1 and 65535"},
+			{WithAnnounceAll("all"), `announce-all must be "tiers" or "urls"`},
+			{WithDryRun(0, 1, 1), "dry-run interval must be at least 1 second"},
+			{WithAnnounceAddresses("", "2001:db8::1", ""), `ipv4 "2001:db8::1" is not an ipv4 address`},
+			{WithEmulation("unknown"), "failed to build the emulated client unknown"},
+		}
+		for _, td := range data {
+			_, err := New(torrent, td.opt)
+			if err == nil || !strings.HasPrefix(err.Error(), td.want) {
+				t.Errorf("got: %v want %v", err, td.want)
+			}
+		}
+	})
+}
+
+func TestStop(t *testing.T) {
+	var events []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events = append(events, r.URL.Query().Get("event"))
+		w.Write([]byte("d8:intervali60ee"))
+	}))
+	defer server.Close()
+
+	torrent := &bencode.TorrentInfo{
+		TotalSize:   4096,
+		PieceSize:   256,
+		TrackerInfo: &bencode.TrackerInfo{Main: server.URL, Urls: []string{server.URL}},
+	}
+	r, err := New(torrent)
+	if err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+	done := make(chan error)
+	go func() { done <- r.Run() }()
+	for started := true; started; {
+		time.Sleep(10 * time.Millisecond)
+		r.mu.Lock()
+		started = r.Trackers[0].Event == "started"
+		r.mu.Unlock()
+	}
+	r.Stop()
+	if err := <-done; err != nil {
+		t.Errorf("should not return error: %v", err)
+	}
+	if r.State != StateStopped || !reflect.DeepEqual(events, []string{"started", "stopped"}) {
+		t.Errorf("got state %v events %v", r.State, events)
+	}
+}
+
+func TestStopEndsAnnounceLoops(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		events = append(events, r.URL.Query().Get("event"))
+		mu.Unlock()
+		w.Write([]byte("d8:intervali1ee"))
+	}))
+	defer server.Close()
+
+	torrent := &bencode.TorrentInfo{
+		TotalSize:   4096,
+		PieceSize:   256,
+		TrackerInfo: &bencode.TrackerInfo{Main: server.URL, Urls: []string{server.URL, server.URL + "/secondary"}},
+	}
+	r, err := New(torrent, WithAnnounceAll(input.AnnounceAllUrls))
+	if err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+	if len(r.Trackers) != 2 {
+		t.Fatalf("got %v trackers want 2", len(r.Trackers))
+	}
+	done := make(chan error)
+	go func() { done <- r.Run() }()
+	for started := true; started; {
+		time.Sleep(10 * time.Millisecond)
+		r.mu.Lock()
+		started = r.Trackers[0].Event == "started" || r.Trackers[1].Event == "started"
+		r.mu.Unlock()
+	}
+	r.Stop()
+	if err := <-done; err != nil {
+		t.Errorf("should not return error: %v", err)
+	}
+	mu.Lock()
+	announced := len(events)
+	mu.Unlock()
+
+	time.Sleep(1500 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != announced {
+		t.Errorf("no announce should follow Run, got events %v after %v", events[announced:], events[:announced])
+	}
+	if stopped := events[announced-2:]; !reflect.DeepEqual(stopped, []string{"stopped", "stopped"}) {
+		t.Errorf("got last events %v want both trackers stopped", stopped)
+	}
+}
+
+func TestStopWhileRetrying(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	torrent := &bencode.TorrentInfo{
+		TotalSize:   4096,
+		PieceSize:   256,
+		TrackerInfo: &bencode.TrackerInfo{Main: server.URL, Urls: []string{server.URL}},
+	}
+	r, err := New(torrent)
+	if err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+	done := make(chan error)
+	go func() { done <- r.Run() }()
+	for retrying := false; !retrying; {
+		time.Sleep(10 * time.Millisecond)
+		r.mu.Lock()
+		retrying = r.State == StateRetrying
+		r.mu.Unlock()
+	}
+	r.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("should not return error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run should return without waiting for the next retry")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != 1 {
+		t.Errorf("got %v requests want 1, a tracker never reached has nothing to stop", requests)
+	}
+}
+
+func TestRunAnnounceAllConcurrentTrackers(t *testing.T) {
+	newServer := func(leechers, interval int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "d8:completei5e10:incompletei%de8:intervali%dee", leechers, interval)
+		}))
+	}
+	// the secondary tracker keeps updating the peers while the main one drives the 1s announces
+	main, secondary := newServer(0, 1), newServer(3, 0)
+	defer main.Close()
+	defer secondary.Close()
+
+	torrent := &bencode.TorrentInfo{
+		TotalSize:   1024 * 1024,
+		PieceSize:   256,
+		TrackerInfo: &bencode.TrackerInfo{Main: main.URL, Urls: []string{main.URL, secondary.URL}},
+	}
+	r, err := New(torrent, WithAnnounceAll(input.AnnounceAllUrls), WithDownloadSpeed(1024), WithUploadSpeed(1024), WithWaitForLeechers())
+	if err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+	done := make(chan error)
+	go func() { done <- r.Run() }()
+	for announced := 0; announced < 3; {
+		time.Sleep(50 * time.Millisecond)
+		r.mu.Lock()
+		announced = r.AnnounceCount
+		r.mu.Unlock()
+	}
+	r.Stop()
+	if err := <-done; err != nil {
+		t.Errorf("should not return error: %v", err)
+	}
+	if r.Leechers != 3 || r.AnnounceInterval != 1 {
+		t.Errorf("got leechers %v interval %v want the peers of every tracker and the main interval", r.Leechers, r.AnnounceInterval)
+	}
+}
+
+func TestGenerateNextAnnounceWhileSecondaryAnnounces(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("d8:completei5e10:incompletei3e8:intervali0ee"))
+	}))
+	defer server.Close()
+
+	torrent := &bencode.TorrentInfo{
+		TotalSize:   1024 * 1024,
+		PieceSize:   256,
+		TrackerInfo: &bencode.TrackerInfo{Main: server.URL, Urls: []string{server.URL, server.URL + "/secondary"}},
+	}
+	r, err := New(torrent, WithAnnounceAll(input.AnnounceAllUrls), WithUploadSpeed(1024), WithWaitForLeechers())
+	if err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+	r.addAnnounce(0, 0, torrent.TotalSize, 0, nil)
+	go r.announceLoop(r.Trackers[1])
+	defer r.Stop()
+	for deadline := time.Now().Add(500 * time.Millisecond); time.Now().Before(deadline); {
+		r.generateNextAnnounce()
+	}
+}
@@ -0,0 +1,188 @@
+package record
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"ratio-spoof/tracker"
+	"sync"
+	"time"
+)
+
+// Session describes the announce session a recording was made from
+type Session struct {
+	Client    string `json:"client"`
+	InfoHash  string `json:"infoHash"`
+	PieceSize int    `json:"pieceSize"`
+	Port      int    `json:"port"`
+	PeerId    string `json:"peerId"`
+	Key       string `json:"key"`
+	// IP, IPv4 and IPv6 are the addresses sent in the {ip}, {ipv4} and {ipv6} query placeholders
+	IP   string `json:"ip,omitempty"`
+	IPv4 string `json:"ipv4,omitempty"`
+	IPv6 string `json:"ipv6,omitempty"`
+}
+
+// Candidates are the amounts handed to the rounding generator before an announce
+type Candidates struct {
+	Downloaded int `json:"downloaded"`
+	Uploaded   int `json:"uploaded"`
+	Left       int `json:"left"`
+}
+
+// Announce holds the values an announce query was built from
+type Announce struct {
+	Downloaded int         `json:"downloaded"`
+	Uploaded   int         `json:"uploaded"`
+	Left       int         `json:"left"`
+	Event      string      `json:"event"`
+	NumWant    int         `json:"numwant"`
+	Candidates *Candidates `json:"candidates,omitempty"`
+}
+
+// Response is the decoded tracker response of a recorded request
+type Response struct {
+	Interval    int `json:"interval"`
+	MinInterval int `json:"minInterval"`
+	Seeders     int `json:"seeders"`
+	Leechers    int `json:"leechers"`
+}
+
+// Request is a single recorded tracker request
+type Request struct {
+	Time     time.Time         `json:"time"`
+	URL      string            `json:"url"`
+	Query    string            `json:"query"`
+	Headers  map[string]string `json:"headers"`
+	Response *Response         `json:"response,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Announce Announce          `json:"announce"`
+}
+
+// Recording is a session loaded back from a record file
+type Recording struct {
+	Session  Session
+	Requests []Request
+}
+
+// line is how each entry is stored, the first line holds the session and the others one request each
+type line struct {
+	Session *Session `json:"session,omitempty"`
+	Request *Request `json:"request,omitempty"`
+}
+
+// Recorder writes every tracker request of a session to a file as JSON lines
+type Recorder struct {
+	mu       sync.Mutex
+	announce Announce
+	w        *writer
+}
+
+// writer is the file shared between a recorder and its forks
+type writer struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	err     error
+}
+
+// Create truncates the file at path and writes the session header to it
+func Create(path string, session Session) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &writer{file: f, encoder: json.NewEncoder(f)}
+	w.encoder.SetEscapeHTML(false)
+	if err := w.encoder.Encode(line{Session: &session}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Recorder{w: w}, nil
+}
+
+// Fork returns a recorder writing to the same file with its own announce values, so trackers
+// announced to concurrently can be recorded at the same time
+func (r *Recorder) Fork() *Recorder {
+	return &Recorder{w: r.w}
+}
+
+// SetAnnounce sets the announce values attached to the requests recorded from now on
+func (r *Recorder) SetAnnounce(a Announce) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.announce = a
+}
+
+// RecordRequest implements tracker.RequestRecorder
+func (r *Recorder) RecordRequest(req tracker.RequestRecord) {
+	r.mu.Lock()
+	entry := Request{Time: req.Time, URL: req.URL, Query: req.Query, Headers: req.Headers, Announce: r.announce}
+	r.mu.Unlock()
+	if req.Response != nil {
+		entry.Response = &Response{
+			Interval:    req.Response.Interval,
+			MinInterval: req.Response.MinInterval,
+			Seeders:     req.Response.Seeders,
+			Leechers:    req.Response.Leechers,
+		}
+	}
+	if req.Err != nil {
+		entry.Error = req.Err.Error()
+	}
+
+	r.w.mu.Lock()
+	defer r.w.mu.Unlock()
+	if r.w.err == nil {
+		r.w.err = r.w.encoder.Encode(line{Request: &entry})
+	}
+}
+
+// Close closes the file and returns the first error found while recording
+func (r *Recorder) Close() error {
+	r.w.mu.Lock()
+	defer r.w.mu.Unlock()
+	err := r.w.file.Close()
+	if r.w.err != nil {
+		return r.w.err
+	}
+	return err
+}
+
+// Load reads a file written by a Recorder
+func Load(path string) (*Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rec Recording
+	var hasSession bool
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var l line
+		if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+			return nil, err
+		}
+		switch {
+		case l.Session != nil:
+			rec.Session = *l.Session
+			hasSession = true
+		case l.Request != nil:
+			rec.Requests = append(rec.Requests, *l.Request)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !hasSession {
+		return nil, errors.New("record file has no session")
+	}
+	return &rec, nil
+}
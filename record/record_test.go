@@ -0,0 +1,173 @@
+package record
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"ratio-spoof/emulation"
+	"ratio-spoof/tracker"
+	"reflect"
+	"testing"
+)
+
+func recordSession(t *testing.T, path string) {
+	t.Helper()
+	client, _ := emulation.NewEmulation("qbit-5.0.4")
+	session := Session{Client: "qbit-5.0.4", InfoHash: "%b1h%0aU", PieceSize: 1024, Port: 8999, PeerId: client.PeerId(), Key: client.Key()}
+	rec, err := Create(path, session)
+	if err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+	tr := &tracker.HttpTracker{Tiers: [][]string{{"http://url1/announce"}}, Recorder: rec,
+		DryRun: &tracker.DryRunConfig{Interval: 10, Seeders: 1, Leechers: 2, Logger: log.New(io.Discard, "", 0)}}
+
+	announces := []Announce{
+		{Downloaded: 0, Uploaded: 0, Left: 4096, Event: "started", NumWant: 200},
+		{Downloaded: 2048, Uploaded: 16384, Left: 2048, NumWant: 200, Candidates: &Candidates{Downloaded: 2048, Uploaded: 20000, Left: 2048}},
+	}
+	for _, a := range announces {
+		rec.SetAnnounce(a)
+		query := client.BuildQuery(emulation.AnnounceValues{InfoHash: session.InfoHash, PeerId: session.PeerId, Key: session.Key, Port: session.Port,
+			Uploaded: a.Uploaded, Downloaded: a.Downloaded, Left: a.Left, Event: a.Event, NumWant: a.NumWant})
+		tr.Announce(query, client.Headers, tracker.NoRetry)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+}
+
+func TestRecordAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	recordSession(t, path)
+
+	rec, err := Load(path)
+	if err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+	if rec.Session.Client != "qbit-5.0.4" || rec.Session.PieceSize != 1024 {
+		t.Errorf("session was not loaded: %+v", rec.Session)
+	}
+	if len(rec.Requests) != 2 {
+		t.Fatalf("got %v requests want %v", len(rec.Requests), 2)
+	}
+	got := rec.Requests[1].Response
+	want := &Response{Interval: 10, Seeders: 1, Leechers: 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v want %v", got, want)
+	}
+	if rec.Requests[0].Announce.Event != "started" {
+		t.Errorf("got: %v want %v", rec.Requests[0].Announce.Event, "started")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	recordSession(t, path)
+
+	t.Run("Unchanged session has no mismatches", func(t *testing.T) {
+		var requests int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Write([]byte("d8:completei1e10:incompletei2e8:intervali10ee"))
+		}))
+		defer server.Close()
+
+		rec, _ := Load(path)
+		mismatches, err := Replay(rec, ReplayOptions{BaseURL: server.URL + "/announce"})
+		if err != nil {
+			t.Fatalf("should not return error: %v", err)
+		}
+		if len(mismatches) != 0 {
+			t.Errorf("got mismatches %v", mismatches)
+		}
+		if requests != 2 {
+			t.Errorf("got %v requests want %v", requests, 2)
+		}
+	})
+
+	t.Run("Changed rounding and headers are reported", func(t *testing.T) {
+		rec, _ := Load(path)
+		rec.Requests[1].Announce.Candidates.Uploaded = 40000
+		rec.Requests[0].Headers["User-Agent"] = "qBittorrent/4.6.5"
+
+		got, _ := Replay(rec, ReplayOptions{})
+		want := []Mismatch{
+			{Request: 1, Field: "header User-Agent", Recorded: "qBittorrent/4.6.5", Current: "qBittorrent/5.0.4"},
+			{Request: 2, Field: "query uploaded", Recorded: "16384", Current: "32768"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got: %v want %v", got, want)
+		}
+	})
+}
+
+func TestDiffQuery(t *testing.T) {
+	got := diffQuery("a=1&b=2&c=3", "a=1&c=3&d=4")
+	want := []Mismatch{
+		{Field: "query b", Recorded: "2", Current: emulation.MissingValue},
+		{Field: "query d", Recorded: emulation.MissingValue, Current: "4"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v want %v", got, want)
+	}
+
+	got = diffQuery("a=1&b=2", "b=2&a=1")
+	want = []Mismatch{{Field: "query order", Recorded: "a&b", Current: "b&a"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v want %v", got, want)
+	}
+}
+
+func TestReplayAddresses(t *testing.T) {
+	dir := t.TempDir()
+	profile, _ := emulation.LoadClientInfo("qbit-5.0.4", "")
+	profile.Query += "&ip={ip?}&ipv4={ipv4?}&ipv6={ipv6?}"
+	profilePath := filepath.Join(dir, "addresses.json")
+	data, _ := json.Marshal(profile)
+	if err := os.WriteFile(profilePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	client, err := emulation.NewEmulation(profilePath)
+	if err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+
+	path := filepath.Join(dir, "session.jsonl")
+	session := Session{Client: profilePath, InfoHash: "%b1h%0aU", PieceSize: 1024, Port: 8999, PeerId: client.PeerId(), Key: client.Key(),
+		IP: "tracker.example.org", IPv4: "203.0.113.7", IPv6: "2001:db8::1"}
+	rec, err := Create(path, session)
+	if err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+	tr := &tracker.HttpTracker{Tiers: [][]string{{"http://url1/announce"}}, Recorder: rec,
+		DryRun: &tracker.DryRunConfig{Interval: 10, Logger: log.New(io.Discard, "", 0)}}
+	announce := Announce{Left: 4096, Event: "started", NumWant: 200}
+	rec.SetAnnounce(announce)
+	tr.Announce(client.BuildQuery(emulation.AnnounceValues{InfoHash: session.InfoHash, PeerId: session.PeerId, Key: session.Key, Port: session.Port,
+		Left: announce.Left, Event: announce.Event, NumWant: announce.NumWant, IP: session.IP, IPv4: session.IPv4, IPv6: session.IPv6}), client.Headers, tracker.NoRetry)
+	if err := rec.Close(); err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+	if loaded.Session.IP != session.IP || loaded.Session.IPv4 != session.IPv4 || loaded.Session.IPv6 != session.IPv6 {
+		t.Errorf("got session %+v want the announced addresses", loaded.Session)
+	}
+	if mismatches, err := Replay(loaded, ReplayOptions{}); err != nil || len(mismatches) != 0 {
+		t.Errorf("got mismatches %v error %v", mismatches, err)
+	}
+
+	loaded.Session.IPv4 = ""
+	got, _ := Replay(loaded, ReplayOptions{})
+	want := []Mismatch{{Request: 1, Field: "query ipv4", Recorded: "203.0.113.7", Current: emulation.MissingValue}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v want %v", got, want)
+	}
+}
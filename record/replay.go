@@ -0,0 +1,97 @@
+package record
+
+import (
+	"ratio-spoof/emulation"
+	"ratio-spoof/tracker"
+	"time"
+)
+
+// ReplayOptions controls how a recording is replayed
+type ReplayOptions struct {
+	// BaseURL is the announce url the requests are re-issued against, when empty the queries are only compared
+	BaseURL string
+	// RealTime keeps the recorded delay between requests instead of sending them back to back
+	RealTime bool
+}
+
+// Mismatch is a difference between a recorded request and the one produced by the current code
+type Mismatch struct {
+	Request  int
+	Field    string
+	Recorded string
+	Current  string
+}
+
+// Replay rebuilds every recorded request with the current emulation and rounding code, compares the
+// result against the recording and optionally sends it to opts.BaseURL
+func Replay(rec *Recording, opts ReplayOptions) ([]Mismatch, error) {
+	client, err := emulation.NewEmulation(rec.Session.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	var mismatches []Mismatch
+	for idx, req := range rec.Requests {
+		a := req.Announce
+		values := emulation.AnnounceValues{
+			InfoHash:   rec.Session.InfoHash,
+			PeerId:     rec.Session.PeerId,
+			Key:        rec.Session.Key,
+			Port:       rec.Session.Port,
+			Uploaded:   a.Uploaded,
+			Downloaded: a.Downloaded,
+			Left:       a.Left,
+			Event:      a.Event,
+			NumWant:    a.NumWant,
+			IP:         rec.Session.IP,
+			IPv4:       rec.Session.IPv4,
+			IPv6:       rec.Session.IPv6,
+		}
+		if c := a.Candidates; c != nil {
+			values.Downloaded, values.Uploaded, values.Left = client.Round(c.Downloaded, c.Uploaded, c.Left, rec.Session.PieceSize)
+		}
+		query := client.BuildQuery(values)
+
+		for _, m := range diffQuery(req.Query, query) {
+			m.Request = idx + 1
+			mismatches = append(mismatches, m)
+		}
+		for _, m := range diffHeaders(req.Headers, client.Headers) {
+			m.Request = idx + 1
+			mismatches = append(mismatches, m)
+		}
+
+		if opts.BaseURL == "" {
+			continue
+		}
+		if opts.RealTime && idx > 0 {
+			time.Sleep(req.Time.Sub(rec.Requests[idx-1].Time))
+		}
+		t := &tracker.HttpTracker{Tiers: [][]string{{opts.BaseURL}}}
+		if _, err := t.Announce(query, client.Headers, tracker.NoRetry); err != nil {
+			recorded := "ok"
+			if req.Error != "" {
+				recorded = req.Error
+			}
+			mismatches = append(mismatches, Mismatch{Request: idx + 1, Field: "request", Recorded: recorded, Current: err.Error()})
+		}
+	}
+	return mismatches, nil
+}
+
+func diffQuery(recorded, current string) []Mismatch {
+	return toMismatches(emulation.DiffQuery(recorded, current))
+}
+
+func diffHeaders(recorded, current map[string]string) []Mismatch {
+	return toMismatches(emulation.DiffHeaders(recorded, current))
+}
+
+// toMismatches reads the differences between the recorded and current values as request mismatches
+func toMismatches(differences []emulation.Difference) []Mismatch {
+	var result []Mismatch
+	for _, d := range differences {
+		result = append(result, Mismatch{Field: d.Field, Recorded: d.A, Current: d.B})
+	}
+	return result
+}
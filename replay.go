@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"ratio-spoof/record"
+)
+
+func runReplay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	baseURL := flags.String("base-url", "", "announce url to re-issue the recorded requests against")
+	realTime := flags.Bool("real-time", false, "wait the recorded time between requests instead of sending them back to back")
+	flags.Usage = func() {
+		fmt.Printf("usage: %s replay [-base-url URL] [-real-time] <FILE>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitSetupError
+	}
+
+	rec, err := record.Load(flags.Arg(0))
+	if err != nil {
+		fmt.Printf("Error loading the record file: %v\n", err)
+		return exitSetupError
+	}
+
+	mismatches, err := record.Replay(rec, record.ReplayOptions{BaseURL: *baseURL, RealTime: *realTime})
+	if err != nil {
+		fmt.Printf("Error replaying the record file: %v\n", err)
+		return exitFailed
+	}
+
+	for _, m := range mismatches {
+		fmt.Printf("#%v %s\n\trecorded: %s\n\tcurrent:  %s\n", m.Request, m.Field, m.Recorded, m.Current)
+	}
+	if len(mismatches) > 0 {
+		fmt.Printf("%v requests replayed, %v differences found\n", len(rec.Requests), len(mismatches))
+		return exitFailed
+	}
+	fmt.Printf("%v requests replayed, no differences found\n", len(rec.Requests))
+	return 0
+}
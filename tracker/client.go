@@ -0,0 +1,232 @@
+package tracker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const defaultRequestTimeout = 30 * time.Second
+
+// defaultClient is used by trackers without a Client so a hung tracker can not block the announces forever
+var defaultClient, _ = NewHTTPClient(ClientConfig{})
+
+// ClientConfig describes the http client used to reach the trackers
+type ClientConfig struct {
+	// Timeout limits each request, defaults to 30 seconds
+	Timeout time.Duration
+	// Proxy is an http, https or socks5 url, when empty the proxy environment variables are used
+	Proxy string
+	// CABundle is a PEM file with certificates trusted on top of the system ones
+	CABundle           string
+	InsecureSkipVerify bool
+	DisableKeepAlives  bool
+	MaxIdleConns       int
+	IdleConnTimeout    time.Duration
+	// SourceInterface is the name or the ip address of the local interface the connections are made from
+	SourceInterface string
+	// Network forces the connections over tcp4 or tcp6, the system picks the family when empty
+	Network string
+}
+
+// NewHTTPClient builds the http client described by the config
+func NewHTTPClient(cfg ClientConfig) (*http.Client, error) {
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultRequestTimeout
+	}
+	if timeout < 0 {
+		return nil, errors.New("http timeout can not be negative")
+	}
+
+	switch cfg.Network {
+	case "", "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("network must be tcp, tcp4 or tcp6, got %q", cfg.Network)
+	}
+
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	if cfg.SourceInterface != "" {
+		ip, err := sourceAddress(cfg.SourceInterface, cfg.Network)
+		if err != nil {
+			return nil, err
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	dial := dialer.DialContext
+	if cfg.Network != "" {
+		dial = func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, cfg.Network, addr)
+		}
+	}
+
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dial,
+		TLSHandshakeTimeout: 10 * time.Second,
+		DisableKeepAlives:   cfg.DisableKeepAlives,
+		MaxIdleConns:        cfg.MaxIdleConns,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
+		TLSClientConfig:     &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify},
+		// the emulated client headers decide the accepted encodings, the responses are decoded by the tracker
+		DisableCompression: true,
+	}
+	if transport.IdleConnTimeout == 0 {
+		transport.IdleConnTimeout = 90 * time.Second
+	}
+
+	if cfg.Proxy != "" {
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("proxy scheme must be http, https, socks5 or socks5h, got %q", proxyURL.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if cfg.CABundle != "" {
+		pem, err := os.ReadFile(cfg.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", cfg.CABundle)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// sourceAddress resolves an ip address or the first address of the interface with the given name, an
+// ipv4 one unless the network is tcp6
+func sourceAddress(source, network string) (net.IP, error) {
+	if ip := net.ParseIP(source); ip != nil {
+		return ip, nil
+	}
+	iface, err := net.InterfaceByName(source)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	var fallback net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		isIPv4 := ipNet.IP.To4() != nil
+		switch {
+		case network == "tcp4" && !isIPv4, network == "tcp6" && isIPv4:
+			continue
+		case isIPv4 || network == "tcp6":
+			return ipNet.IP, nil
+		}
+		if fallback == nil {
+			fallback = ipNet.IP
+		}
+	}
+	if fallback == nil {
+		return nil, fmt.Errorf("interface %s has no %sip address", source, familyName(network))
+	}
+	return fallback, nil
+}
+
+// LocalAddress returns the first public address of the given family found on the interfaces that are
+// up, or on the interface named or owning the ip address ifaceName, nil when there is none
+func LocalAddress(ipv6 bool, ifaceName string) (net.IP, error) {
+	var ifaces []net.Interface
+	if ifaceName != "" {
+		iface, err := interfaceByAddress(ifaceName)
+		if err != nil {
+			return nil, err
+		}
+		ifaces = []net.Interface{*iface}
+	} else {
+		var err error
+		if ifaces, err = net.Interfaces(); err != nil {
+			return nil, err
+		}
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && isPublicAddress(ipNet.IP, ipv6) {
+				return ipNet.IP, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// interfaceByAddress returns the interface of the given name, or the one owning the given ip address
+func interfaceByAddress(source string) (*net.Interface, error) {
+	ip := net.ParseIP(source)
+	if ip == nil {
+		return net.InterfaceByName(source)
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				return &iface, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no interface has the address %s", source)
+}
+
+func isPublicAddress(ip net.IP, ipv6 bool) bool {
+	if (ip.To4() == nil) != ipv6 {
+		return false
+	}
+	return ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
+
+func familyName(network string) string {
+	switch network {
+	case "tcp4":
+		return "ipv4 "
+	case "tcp6":
+		return "ipv6 "
+	}
+	return ""
+}
+
+func (t *HttpTracker) httpClient() *http.Client {
+	if t.Client != nil {
+		return t.Client
+	}
+	return defaultClient
+}
@@ -0,0 +1,179 @@
+package tracker
+
+import (
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	t.Run("Default timeout is applied", func(t *testing.T) {
+		client, err := NewHTTPClient(ClientConfig{})
+		if err != nil {
+			t.Fatalf("should not return error: %v", err)
+		}
+		if client.Timeout != defaultRequestTimeout {
+			t.Errorf("got: %v want %v", client.Timeout, defaultRequestTimeout)
+		}
+	})
+
+	t.Run("Hung tracker times out", func(t *testing.T) {
+		done := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-done
+		}))
+		defer server.Close()
+		defer close(done)
+
+		client, _ := NewHTTPClient(ClientConfig{Timeout: 50 * time.Millisecond})
+		tracker := &HttpTracker{Tiers: [][]string{{server.URL}}, Client: client}
+		if _, err := tracker.Announce("a=1", nil, NoRetry); err == nil {
+			t.Error("should return error")
+		}
+	})
+
+	t.Run("Requests go through the proxy", func(t *testing.T) {
+		var proxied string
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proxied = r.URL.String()
+			w.Write([]byte("d8:intervali900ee"))
+		}))
+		defer proxy.Close()
+
+		client, err := NewHTTPClient(ClientConfig{Proxy: proxy.URL})
+		if err != nil {
+			t.Fatalf("should not return error: %v", err)
+		}
+		tracker := &HttpTracker{Tiers: [][]string{{"http://tracker.invalid/announce"}}, Client: client}
+		if _, err := tracker.Announce("a=1", nil, NoRetry); err != nil {
+			t.Fatalf("should not return error: %v", err)
+		}
+		if proxied != "http://tracker.invalid/announce?a=1" {
+			t.Errorf("got: %v want %v", proxied, "http://tracker.invalid/announce?a=1")
+		}
+	})
+
+	t.Run("Self-signed tracker with insecure skip verify", func(t *testing.T) {
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("d8:intervali900ee"))
+		}))
+		server.Config.ErrorLog = log.New(io.Discard, "", 0)
+		server.StartTLS()
+		defer server.Close()
+
+		client, _ := NewHTTPClient(ClientConfig{})
+		tracker := &HttpTracker{Tiers: [][]string{{server.URL}}, Client: client}
+		if _, err := tracker.Announce("a=1", nil, NoRetry); err == nil {
+			t.Error("should not trust a self-signed certificate")
+		}
+
+		client, _ = NewHTTPClient(ClientConfig{InsecureSkipVerify: true})
+		tracker = &HttpTracker{Tiers: [][]string{{server.URL}}, Client: client}
+		if _, err := tracker.Announce("a=1", nil, NoRetry); err != nil {
+			t.Errorf("should not return error: %v", err)
+		}
+	})
+
+	t.Run("Source interface ip is used as local address", func(t *testing.T) {
+		client, err := NewHTTPClient(ClientConfig{SourceInterface: "127.0.0.1"})
+		if err != nil {
+			t.Fatalf("should not return error: %v", err)
+		}
+		var remote string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			remote, _, _ = net.SplitHostPort(r.RemoteAddr)
+			w.Write([]byte("d8:intervali900ee"))
+		}))
+		defer server.Close()
+		tracker := &HttpTracker{Tiers: [][]string{{server.URL}}, Client: client}
+		tracker.Announce("a=1", nil, NoRetry)
+		if remote != "127.0.0.1" {
+			t.Errorf("got: %v want %v", remote, "127.0.0.1")
+		}
+	})
+
+	t.Run("Network forces the address family", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("d8:intervali900ee"))
+		}))
+		defer server.Close()
+
+		client, _ := NewHTTPClient(ClientConfig{Network: "tcp4"})
+		tracker := &HttpTracker{Tiers: [][]string{{server.URL}}, Client: client}
+		if _, err := tracker.Announce("a=1", nil, NoRetry); err != nil {
+			t.Errorf("should not return error: %v", err)
+		}
+
+		client, _ = NewHTTPClient(ClientConfig{Network: "tcp6"})
+		tracker = &HttpTracker{Tiers: [][]string{{server.URL}}, Client: client}
+		if _, err := tracker.Announce("a=1", nil, NoRetry); err == nil {
+			t.Error("should not reach an ipv4 tracker over tcp6")
+		}
+	})
+
+	t.Run("Invalid configs return errors", func(t *testing.T) {
+		bundle := filepath.Join(t.TempDir(), "ca.pem")
+		os.WriteFile(bundle, []byte("not a certificate"), 0o600)
+
+		data := []struct {
+			cfg  ClientConfig
+			want string
+		}{
+			{ClientConfig{Proxy: "ftp://proxy"}, `proxy scheme must be http, https, socks5 or socks5h, got "ftp"`},
+			{ClientConfig{CABundle: bundle}, "no certificate found in " + bundle},
+			{ClientConfig{Timeout: -time.Second}, "http timeout can not be negative"},
+			{ClientConfig{SourceInterface: "no-such-interface0"}, "no such network interface"},
+			{ClientConfig{Network: "udp"}, `network must be tcp, tcp4 or tcp6, got "udp"`},
+		}
+		for _, td := range data {
+			_, err := NewHTTPClient(td.cfg)
+			if err == nil || !strings.Contains(err.Error(), td.want) {
+				t.Errorf("got: %v want %v", err, td.want)
+			}
+		}
+	})
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	data := []struct {
+		ip   string
+		ipv6 bool
+		want bool
+	}{
+		{"203.0.113.7", false, true},
+		{"203.0.113.7", true, false},
+		{"192.168.1.10", false, false},
+		{"127.0.0.1", false, false},
+		{"169.254.1.1", false, false},
+		{"2001:db8::1", true, true},
+		{"2001:db8::1", false, false},
+		{"fd00::1", true, false},
+		{"fe80::1", true, false},
+		{"::1", true, false},
+	}
+	for _, td := range data {
+		if got := isPublicAddress(net.ParseIP(td.ip), td.ipv6); got != td.want {
+			t.Errorf("%v ipv6=%v: got %v want %v", td.ip, td.ipv6, got, td.want)
+		}
+	}
+}
+
+func TestLocalAddress(t *testing.T) {
+	ip, err := LocalAddress(false, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("an interface given by its ip address should be found: %v", err)
+	}
+	if ip != nil {
+		t.Errorf("got %v want no public address on the loopback interface", ip)
+	}
+	if _, err := LocalAddress(false, "203.0.113.7"); err == nil {
+		t.Error("should return error for an address owned by no interface")
+	}
+}
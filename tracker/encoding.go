@@ -0,0 +1,91 @@
+package tracker
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// defaultMaxResponseSize is the most read from a tracker response, before and after decompression,
+// real responses are a few KiB
+const defaultMaxResponseSize = 1024 * 1024
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// responseTooLargeError is returned when a response goes over the size limit
+type responseTooLargeError struct {
+	limit int64
+}
+
+func (e *responseTooLargeError) Error() string {
+	return fmt.Sprintf("response is bigger than %d bytes", e.limit)
+}
+
+// readLimited reads r failing when there are more than limit bytes instead of truncating
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		return nil, &responseTooLargeError{limit: limit}
+	}
+	return b, nil
+}
+
+// decodeContent undoes the encodings listed in the Content-Encoding header, in reverse order as they
+// were applied. A body sent without the header is still gunzipped when it starts with the gzip magic
+// number, as some trackers do that. Brotli is not supported as no emulated client asks for it
+func decodeContent(body []byte, contentEncoding string, limit int64) ([]byte, error) {
+	var encodings []string
+	for _, encoding := range strings.Split(contentEncoding, ",") {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if encoding != "" && encoding != "identity" {
+			encodings = append(encodings, encoding)
+		}
+	}
+	if len(encodings) == 0 && bytes.HasPrefix(body, gzipMagic) {
+		encodings = append(encodings, "gzip")
+	}
+
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var err error
+		switch encodings[i] {
+		case "gzip", "x-gzip":
+			body, err = gunzip(body, limit)
+		case "deflate":
+			body, err = inflate(body, limit)
+		default:
+			return nil, fmt.Errorf("unsupported content encoding %q", encodings[i])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+func gunzip(body []byte, limit int64) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimited(r, limit)
+}
+
+// inflate handles deflate bodies sent with the zlib wrapper, as the http spec says, or raw as some
+// servers do
+func inflate(body []byte, limit int64) ([]byte, error) {
+	if r, err := zlib.NewReader(bytes.NewReader(body)); err == nil {
+		defer r.Close()
+		return readLimited(r, limit)
+	}
+	r := flate.NewReader(bytes.NewReader(body))
+	defer r.Close()
+	return readLimited(r, limit)
+}
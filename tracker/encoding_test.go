@@ -0,0 +1,121 @@
+package tracker
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const encodingTestResponse = "d8:completei5e10:incompletei3e8:intervali900ee"
+
+func compress(t *testing.T, newWriter func(io.Writer) io.WriteCloser, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := newWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func gzipWriter(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+
+func zlibWriter(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }
+
+func flateWriter(w io.Writer) io.WriteCloser {
+	fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+	return fw
+}
+
+func TestAnnounceContentEncoding(t *testing.T) {
+	body := []byte(encodingTestResponse)
+	data := []struct {
+		name     string
+		encoding string
+		body     []byte
+		err      string
+	}{
+		{name: "identity", body: body},
+		{name: "explicit identity", encoding: "identity", body: body},
+		{name: "gzip", encoding: "gzip", body: compress(t, gzipWriter, body)},
+		{name: "gzip without header", body: compress(t, gzipWriter, body)},
+		{name: "deflate with zlib wrapper", encoding: "deflate", body: compress(t, zlibWriter, body)},
+		{name: "raw deflate", encoding: "deflate", body: compress(t, flateWriter, body)},
+		{name: "stacked encodings", encoding: "deflate, gzip", body: compress(t, gzipWriter, compress(t, zlibWriter, body))},
+		{name: "brotli is not supported", encoding: "br", body: body, err: `unsupported content encoding "br"`},
+		{name: "broken gzip", encoding: "gzip", body: body, err: "gzip: invalid header"},
+	}
+
+	for _, td := range data {
+		t.Run(td.name, func(t *testing.T) {
+			var acceptEncoding string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				acceptEncoding = r.Header.Get("Accept-Encoding")
+				if td.encoding != "" {
+					w.Header().Set("Content-Encoding", td.encoding)
+				}
+				w.Write(td.body)
+			}))
+			defer server.Close()
+
+			tracker := &HttpTracker{Tiers: [][]string{{server.URL}}}
+			resp, err := tracker.Announce("a=1", nil, NoRetry)
+			if acceptEncoding != "" {
+				t.Errorf("only the emulated headers should be sent, got Accept-Encoding %q", acceptEncoding)
+			}
+			if td.err != "" {
+				var decodeErr *DecodeError
+				if !errors.As(err, &decodeErr) || !strings.Contains(err.Error(), td.err) {
+					t.Errorf("got: %v want a decode error with %q", err, td.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("should not return error: %v", err)
+			}
+			if resp.Seeders != 5 || resp.Leechers != 3 || resp.Interval != 900 {
+				t.Errorf("got: %+v", resp)
+			}
+			if tracker.LastTackerResponse != encodingTestResponse {
+				t.Errorf("got: %q want %q", tracker.LastTackerResponse, encodingTestResponse)
+			}
+		})
+	}
+}
+
+func TestAnnounceResponseSizeLimit(t *testing.T) {
+	padded := []byte("d8:intervali900e7:padding2048:" + strings.Repeat("x", 2048) + "e")
+	data := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{name: "plain body over the limit", body: padded},
+		{name: "gzip bomb over the limit once decompressed", encoding: "gzip", body: compress(t, gzipWriter, padded)},
+	}
+
+	for _, td := range data {
+		t.Run(td.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if td.encoding != "" {
+					w.Header().Set("Content-Encoding", td.encoding)
+				}
+				w.Write(td.body)
+			}))
+			defer server.Close()
+
+			tracker := &HttpTracker{Tiers: [][]string{{server.URL}}, MaxResponseSize: 1024}
+			_, err := tracker.Announce("a=1", nil, NoRetry)
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) || !strings.Contains(err.Error(), "response is bigger than 1024 bytes") {
+				t.Errorf("got: %v want a size limit error", err)
+			}
+		})
+	}
+}
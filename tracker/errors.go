@@ -0,0 +1,108 @@
+package tracker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// fatalFailureReasons are parts of failure reasons telling that announcing again will not help
+var fatalFailureReasons = []string{
+	"unregistered",
+	"not registered",
+	"torrent not found",
+	"unknown torrent",
+	"banned",
+	"blacklisted",
+	"not whitelisted",
+	"client is not allowed",
+	"invalid passkey",
+	"passkey not found",
+	"unauthorized",
+	"not authorized",
+}
+
+// NetworkError is returned when the tracker could not be reached
+type NetworkError struct {
+	URL string
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("failed to reach %s: %v", e.URL, e.Err)
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatusError is returned when the tracker answers with a status other than 200 without a failure reason
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("tracker %s returned status %d", e.URL, e.StatusCode)
+}
+
+// Retryable tells if the status is worth retrying, client errors other than timeouts and rate
+// limits are not
+func (e *HTTPStatusError) Retryable() bool {
+	if e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return e.StatusCode < 400 || e.StatusCode >= 500
+}
+
+// TrackerFailure is the failure reason sent by the tracker
+type TrackerFailure struct {
+	URL       string
+	Reason    string
+	Retryable bool
+}
+
+func (e *TrackerFailure) Error() string {
+	return fmt.Sprintf("tracker %s refused the announce: %s", e.URL, e.Reason)
+}
+
+// DecodeError is returned when the tracker response is not a valid bencoded dictionary
+type DecodeError struct {
+	URL string
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode the response of %s: %v", e.URL, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func newTrackerFailure(url, reason string) *TrackerFailure {
+	retryable := true
+	lowerReason := strings.ToLower(reason)
+	for _, fatal := range fatalFailureReasons {
+		if strings.Contains(lowerReason, fatal) {
+			retryable = false
+			break
+		}
+	}
+	return &TrackerFailure{URL: url, Reason: reason, Retryable: retryable}
+}
+
+// IsRetryable tells if announcing again may succeed after the error
+func IsRetryable(err error) bool {
+	var failure *TrackerFailure
+	if errors.As(err, &failure) {
+		return failure.Retryable
+	}
+	var status *HTTPStatusError
+	if errors.As(err, &status) {
+		return status.Retryable()
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package tracker
+
+import (
+	"time"
+)
+
+const (
+	defaultBreakerThreshold = 3
+	defaultBreakerCoolDown  = 10 * time.Minute
+)
+
+// UrlHealth is the request history of a single tracker url
+type UrlHealth struct {
+	Successes           int
+	Failures            int
+	ConsecutiveFailures int
+	LastError           string
+	LastLatency         time.Duration
+	// SkipUntil is set when the url failed BreakerThreshold times in a row, it is not tried again
+	// before that time unless every other url is skipped as well
+	SkipUntil time.Time
+}
+
+// Skipped tells if the circuit breaker of the url is open at the given time
+func (h UrlHealth) Skipped(now time.Time) bool {
+	return now.Before(h.SkipUntil)
+}
+
+func (t *HttpTracker) breakerThreshold() int {
+	if t.BreakerThreshold > 0 {
+		return t.BreakerThreshold
+	}
+	return defaultBreakerThreshold
+}
+
+func (t *HttpTracker) breakerCoolDown() time.Duration {
+	if t.BreakerCoolDown > 0 {
+		return t.BreakerCoolDown
+	}
+	return defaultBreakerCoolDown
+}
+
+func (t *HttpTracker) skipped(url string, now time.Time) bool {
+	t.healthMu.Lock()
+	defer t.healthMu.Unlock()
+	h, ok := t.health[url]
+	return ok && h.Skipped(now)
+}
+
+func (t *HttpTracker) updateHealth(url string, latency time.Duration, err error) {
+	t.healthMu.Lock()
+	defer t.healthMu.Unlock()
+	if t.health == nil {
+		t.health = make(map[string]*UrlHealth)
+	}
+	h, ok := t.health[url]
+	if !ok {
+		h = &UrlHealth{}
+		t.health[url] = h
+	}
+	h.LastLatency = latency
+	if err == nil {
+		h.Successes++
+		h.ConsecutiveFailures = 0
+		h.SkipUntil = time.Time{}
+		return
+	}
+	h.Failures++
+	h.ConsecutiveFailures++
+	h.LastError = err.Error()
+	if h.ConsecutiveFailures >= t.breakerThreshold() {
+		h.SkipUntil = time.Now().Add(t.breakerCoolDown())
+	}
+}
+
+// Health returns a copy of the request history of every url tried so far
+func (t *HttpTracker) Health() map[string]UrlHealth {
+	t.healthMu.Lock()
+	defer t.healthMu.Unlock()
+	result := make(map[string]UrlHealth, len(t.health))
+	for url, h := range t.health {
+		result[url] = *h
+	}
+	return result
+}
@@ -1,22 +1,67 @@
 package tracker
 
 import (
-	"bytes"
-	"compress/gzip"
 	"errors"
-	"ratio-spoof/bencode"
-	"io"
+	"fmt"
+	"log"
+	"math/rand"
 	"net/http"
+	"ratio-spoof/bencode"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	defaultRetryDelay = 30 * time.Second
+	maxRetryDelay     = 15 * time.Minute
+)
+
 type HttpTracker struct {
-	Urls                    []string
+	// Tiers are tried in order, the urls of a tier are shuffled on load and the one that answers is
+	// moved to the front of its tier, as described in BEP 12
+	Tiers                   [][]string
 	RetryAttempt            int
 	LastAnounceRequest      string
 	LastTackerResponse      string
 	EstimatedTimeToAnnounce time.Time
+	// Client makes the requests, when nil a client with a 30 seconds timeout is used
+	Client   *http.Client
+	DryRun   *DryRunConfig
+	Recorder RequestRecorder
+	// BreakerThreshold is the number of consecutive failures after which a url is skipped for
+	// BreakerCoolDown, defaults to 3 failures and 10 minutes
+	BreakerThreshold int
+	BreakerCoolDown  time.Duration
+	// MaxResponseSize limits the response size before and after decompression, defaults to 1 MiB
+	MaxResponseSize int64
+	health          map[string]*UrlHealth
+	healthMu        sync.Mutex
+}
+
+// RequestRecord is a request sent to the tracker along with its decoded response
+type RequestRecord struct {
+	Time     time.Time
+	URL      string
+	Query    string
+	Headers  map[string]string
+	Response *TrackerResponse
+	Err      error
+}
+
+// RequestRecorder receives every request the tracker makes
+type RequestRecorder interface {
+	RecordRequest(RequestRecord)
+}
+
+// DryRunConfig makes the tracker log every announce instead of sending it,
+// answering with a simulated response built from the configured values
+type DryRunConfig struct {
+	Interval int
+	Seeders  int
+	Leechers int
+	Logger   *log.Logger
 }
 
 type TrackerResponse struct {
@@ -27,23 +72,66 @@ type TrackerResponse struct {
 }
 
 func NewHttpTracker(torrentInfo *bencode.TorrentInfo) (*HttpTracker, error) {
+	tiers := torrentInfo.TrackerInfo.Tiers
+	if len(tiers) == 0 {
+		for _, url := range torrentInfo.TrackerInfo.Urls {
+			tiers = append(tiers, []string{url})
+		}
+	}
 
-	var result []string
-	for _, url := range torrentInfo.TrackerInfo.Urls {
-		if strings.HasPrefix(url, "http") {
-			result = append(result, url)
+	var result [][]string
+	for _, tier := range tiers {
+		var httpTier []string
+		for _, url := range tier {
+			if strings.HasPrefix(url, "http") {
+				httpTier = append(httpTier, url)
+			}
+		}
+		if len(httpTier) > 0 {
+			rand.Shuffle(len(httpTier), func(i, j int) { httpTier[i], httpTier[j] = httpTier[j], httpTier[i] })
+			result = append(result, httpTier)
 		}
 	}
 	if len(result) == 0 {
 		return nil, errors.New("No tcp/http tracker url announce found")
 	}
-	return &HttpTracker{Urls: torrentInfo.TrackerInfo.Urls}, nil
+	return &HttpTracker{Tiers: result}, nil
+}
+
+// promote moves the url at idx to the front of its tier keeping the order of the others
+func (t *HttpTracker) promote(tierIdx, idx int) {
+	tier := t.Tiers[tierIdx]
+	url := tier[idx]
+	copy(tier[1:idx+1], tier[:idx])
+	tier[0] = url
+}
+
+// Split returns a tracker for each tier, or for each url when perUrl is set, so they can be
+// announced to independently with their own interval and retry state
+func (t *HttpTracker) Split(perUrl bool) []*HttpTracker {
+	var result []*HttpTracker
+	for _, tier := range t.Tiers {
+		if !perUrl {
+			result = append(result, t.withTiers([][]string{append([]string{}, tier...)}))
+			continue
+		}
+		for _, url := range tier {
+			result = append(result, t.withTiers([][]string{{url}}))
+		}
+	}
+	return result
+}
+
+// WithClient returns a copy of the tracker announcing with another http client, used to announce over
+// both ipv4 and ipv6
+func (t *HttpTracker) WithClient(client *http.Client) *HttpTracker {
+	copy := t.withTiers(t.Tiers)
+	copy.Client = client
+	return copy
 }
 
-func (t *HttpTracker) swapFirst(currentIdx int) {
-	aux := t.Urls[0]
-	t.Urls[0] = t.Urls[currentIdx]
-	t.Urls[currentIdx] = aux
+func (t *HttpTracker) withTiers(tiers [][]string) *HttpTracker {
+	return &HttpTracker{Tiers: tiers, Client: t.Client, DryRun: t.DryRun, BreakerThreshold: t.BreakerThreshold, BreakerCoolDown: t.BreakerCoolDown, MaxResponseSize: t.MaxResponseSize}
 }
 
 func (t *HttpTracker) updateEstimatedTimeToAnnounce(interval int) {
@@ -57,79 +145,199 @@ func (t *HttpTracker) handleSuccessfulResponse(resp *TrackerResponse) {
 	t.updateEstimatedTimeToAnnounce(resp.Interval)
 }
 
-func (t *HttpTracker) Announce(query string, headers map[string]string, retry bool) (*TrackerResponse, error) {
+// RetryPolicy tells how a failed announce is retried, errors that are not retryable are returned right away
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first failure, a negative number retries forever
+	MaxRetries int
+	// Delay is the wait before the first retry, doubled on each retry up to 15 minutes, defaults to 30 seconds
+	Delay time.Duration
+	// OnRetry is called with the error before waiting for each retry
+	OnRetry func(attempt int, err error, delay time.Duration)
+	// Cancel stops waiting for the next retry when closed, the last error is then returned
+	Cancel <-chan struct{}
+}
+
+var (
+	// NoRetry returns the first error
+	NoRetry = RetryPolicy{}
+	// RetryForever only gives up on errors that are not retryable
+	RetryForever = RetryPolicy{MaxRetries: -1}
+)
+
+func (t *HttpTracker) Announce(query string, headers map[string]string, policy RetryPolicy) (*TrackerResponse, error) {
 	defer func() {
 		t.RetryAttempt = 0
 	}()
-	if retry {
-		retryDelay := 30
-		for {
-			trackerResp, err := t.tryMakeRequest(query, headers)
-			if err != nil {
-				t.updateEstimatedTimeToAnnounce(retryDelay)
-				t.RetryAttempt++
-				time.Sleep(time.Duration(retryDelay) * time.Second)
-				retryDelay *= 2
-				if retryDelay > 900 {
-					retryDelay = 900
-				}
-				continue
-			}
+	retryDelay := policy.Delay
+	if retryDelay <= 0 {
+		retryDelay = defaultRetryDelay
+	}
+	for {
+		trackerResp, err := t.tryMakeRequest(query, headers)
+		if err == nil {
 			t.handleSuccessfulResponse(trackerResp)
 			return trackerResp, nil
 		}
-
-	} else {
-		resp, err := t.tryMakeRequest(query, headers)
-		if err != nil {
+		if !IsRetryable(err) || (policy.MaxRetries >= 0 && t.RetryAttempt >= policy.MaxRetries) {
 			return nil, err
 		}
-		t.handleSuccessfulResponse(resp)
-		return resp, nil
+		t.EstimatedTimeToAnnounce = time.Now().Add(retryDelay)
+		t.RetryAttempt++
+		if policy.OnRetry != nil {
+			policy.OnRetry(t.RetryAttempt, err, retryDelay)
+		}
+		timer := time.NewTimer(retryDelay)
+		select {
+		case <-timer.C:
+		case <-policy.Cancel:
+			timer.Stop()
+			return nil, err
+		}
+		retryDelay *= 2
+		if retryDelay > maxRetryDelay {
+			retryDelay = maxRetryDelay
+		}
 	}
 }
 
 func (t *HttpTracker) tryMakeRequest(query string, headers map[string]string) (*TrackerResponse, error) {
-	for idx, baseUrl := range t.Urls {
-		completeURL := buildFullUrl(baseUrl, query)
-		t.LastAnounceRequest = completeURL
-		req, _ := http.NewRequest("GET", completeURL, nil)
-		for header, value := range headers {
-			req.Header.Add(header, value)
+	if t.DryRun != nil {
+		requestTime := time.Now()
+		resp := t.simulateRequest(query, headers)
+		t.record(RequestRecord{Time: requestTime, URL: t.LastAnounceRequest, Query: query, Headers: headers, Response: resp})
+		return resp, nil
+	}
+	// urls with an open circuit breaker are skipped unless there is nothing else to try
+	now := time.Now()
+	var attempted bool
+	var lastErr, fatalErr error
+	for _, ignoreBreaker := range []bool{false, true} {
+		if ignoreBreaker && attempted {
+			break
 		}
-		resp, err := http.DefaultClient.Do(req)
-		if err == nil {
-			if resp.StatusCode == http.StatusOK {
-				bytesR, _ := io.ReadAll(resp.Body)
-				if len(bytesR) == 0 {
+		for tierIdx, tier := range t.Tiers {
+			for idx, baseUrl := range tier {
+				if !ignoreBreaker && t.skipped(baseUrl, now) {
 					continue
 				}
-				mimeType := http.DetectContentType(bytesR)
-				if mimeType == "application/x-gzip" {
-					gzipReader, _ := gzip.NewReader(bytes.NewReader(bytesR))
-					bytesR, _ = io.ReadAll(gzipReader)
-					gzipReader.Close()
-				}
-				t.LastTackerResponse = string(bytesR)
-				decodedResp, err := bencode.Decode(bytesR)
-				if err != nil {
-					continue
-				}
-				ret, err := extractTrackerResponse(decodedResp)
+				attempted = true
+				completeURL := buildFullUrl(baseUrl, query)
+				t.LastAnounceRequest = completeURL
+				requestTime := time.Now()
+				ret, err := t.makeRequest(baseUrl, completeURL, headers)
+				t.updateHealth(baseUrl, time.Since(requestTime), err)
+				t.record(RequestRecord{Time: requestTime, URL: completeURL, Query: query, Headers: headers, Response: ret, Err: err})
 				if err != nil {
+					lastErr = err
+					if fatalErr == nil && !IsRetryable(err) {
+						fatalErr = err
+					}
 					continue
 				}
 				if idx != 0 {
-					t.swapFirst(idx)
+					t.promote(tierIdx, idx)
 				}
+				return ret, nil
+			}
+		}
+	}
+	// a refusal is more telling than another url being unreachable
+	if fatalErr != nil {
+		return nil, fatalErr
+	}
+	return nil, lastErr
+}
 
-				return &ret, nil
+// makeRequest sends a single announce, baseUrl is only used to identify the tracker in the errors
+func (t *HttpTracker) makeRequest(baseUrl, completeURL string, headers map[string]string) (*TrackerResponse, error) {
+	req, err := http.NewRequest("GET", completeURL, nil)
+	if err != nil {
+		return nil, &NetworkError{URL: baseUrl, Err: err}
+	}
+	for header, value := range headers {
+		req.Header.Add(header, value)
+	}
+	resp, err := t.httpClient().Do(req)
+	if err != nil {
+		return nil, &NetworkError{URL: baseUrl, Err: err}
+	}
+	defer resp.Body.Close()
+	bytesR, err := readLimited(resp.Body, t.maxResponseSize())
+	if err != nil {
+		if _, ok := err.(*responseTooLargeError); ok {
+			return nil, &DecodeError{URL: baseUrl, Err: err}
+		}
+		return nil, &NetworkError{URL: baseUrl, Err: err}
+	}
+	decoded, decodeErr := decodeContent(bytesR, resp.Header.Get("Content-Encoding"), t.maxResponseSize())
+	if resp.StatusCode != http.StatusOK {
+		// error pages of proxies may not match the announced encoding, the status is reported with the raw body
+		if decodeErr == nil {
+			bytesR = decoded
+		}
+		t.LastTackerResponse = string(bytesR)
+		// trackers often send the failure reason along with a 4xx status
+		if decodedResp, err := bencode.Decode(bytesR); err == nil {
+			if reason, ok := decodedResp["failure reason"].(string); ok && len(reason) > 0 {
+				return nil, newTrackerFailure(baseUrl, reason)
 			}
-			resp.Body.Close()
 		}
+		return nil, &HTTPStatusError{URL: baseUrl, StatusCode: resp.StatusCode, Body: string(bytesR)}
+	}
+	if decodeErr != nil {
+		return nil, &DecodeError{URL: baseUrl, Err: decodeErr}
+	}
+	bytesR = decoded
+	t.LastTackerResponse = string(bytesR)
+
+	if len(bytesR) == 0 {
+		return nil, &DecodeError{URL: baseUrl, Err: errors.New("empty response")}
+	}
+	decodedResp, err := bencode.Decode(bytesR)
+	if err != nil {
+		return nil, &DecodeError{URL: baseUrl, Err: err}
+	}
+	ret, err := extractTrackerResponse(baseUrl, decodedResp)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+func (t *HttpTracker) maxResponseSize() int64 {
+	if t.MaxResponseSize > 0 {
+		return t.MaxResponseSize
+	}
+	return defaultMaxResponseSize
+}
+
+func (t *HttpTracker) record(r RequestRecord) {
+	if t.Recorder != nil {
+		t.Recorder.RecordRequest(r)
+	}
+}
+
+func (t *HttpTracker) simulateRequest(query string, headers map[string]string) *TrackerResponse {
+	completeURL := buildFullUrl(t.Tiers[0][0], query)
+	t.LastAnounceRequest = completeURL
+
+	logger := t.DryRun.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	var headerNames []string
+	for header := range headers {
+		headerNames = append(headerNames, header)
+	}
+	sort.Strings(headerNames)
+	logger.Printf("GET %s", completeURL)
+	for _, header := range headerNames {
+		logger.Printf("\t%s: %s", header, headers[header])
 	}
-	return nil, errors.New("Connection error with the tracker")
 
+	resp := TrackerResponse{Interval: t.DryRun.Interval, Seeders: t.DryRun.Seeders, Leechers: t.DryRun.Leechers}
+	t.LastTackerResponse = fmt.Sprintf("d8:completei%de10:incompletei%de8:intervali%dee", resp.Seeders, resp.Leechers, resp.Interval)
+	return &resp
 }
 
 func buildFullUrl(baseurl, query string) string {
@@ -139,10 +347,10 @@ func buildFullUrl(baseurl, query string) string {
 	return baseurl + "?" + strings.TrimLeft(query, "?")
 }
 
-func extractTrackerResponse(datatrackerResponse map[string]interface{}) (TrackerResponse, error) {
+func extractTrackerResponse(baseUrl string, datatrackerResponse map[string]interface{}) (TrackerResponse, error) {
 	var result TrackerResponse
 	if v, ok := datatrackerResponse["failure reason"].(string); ok && len(v) > 0 {
-		return result, errors.New(v)
+		return result, newTrackerFailure(baseUrl, v)
 	}
 	result.MinInterval, _ = datatrackerResponse["min interval"].(int)
 	result.Interval, _ = datatrackerResponse["interval"].(int)
@@ -1,9 +1,16 @@
 package tracker
 
 import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
 	"ratio-spoof/bencode"
 	"reflect"
+	"sort"
 	"testing"
+	"time"
 )
 
 func TestNewHttpTracker(t *testing.T) {
@@ -16,18 +23,73 @@ func TestNewHttpTracker(t *testing.T) {
 	}
 }
 
-func TestSwapFirst(t *testing.T) {
-	tracker, _ := NewHttpTracker(&bencode.TorrentInfo{TrackerInfo: &bencode.TrackerInfo{Urls: []string{"http://url1", "http://url2", "http://url3", "http://url4"}}})
-	tracker.swapFirst(3)
+func TestNewHttpTrackerTiers(t *testing.T) {
+	tiers := [][]string{{"http://url1", "udp://url2", "http://url3"}, {"udp://url4"}, {"http://url5"}}
+	tracker, _ := NewHttpTracker(&bencode.TorrentInfo{TrackerInfo: &bencode.TrackerInfo{Tiers: tiers}})
 
-	got := tracker.Urls
-	want := []string{"http://url4", "http://url2", "http://url3", "http://url1"}
+	if len(tracker.Tiers) != 2 {
+		t.Fatalf("got: %v want %v tiers", len(tracker.Tiers), 2)
+	}
+	got := append([]string{}, tracker.Tiers[0]...)
+	sort.Strings(got)
+	want := []string{"http://url1", "http://url3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v want %v", got, want)
+	}
+	if !reflect.DeepEqual(tracker.Tiers[1], []string{"http://url5"}) {
+		t.Errorf("got: %v want %v", tracker.Tiers[1], []string{"http://url5"})
+	}
+}
+
+func TestPromote(t *testing.T) {
+	tracker := &HttpTracker{Tiers: [][]string{{"http://url1", "http://url2", "http://url3", "http://url4"}, {"http://url5"}}}
+	tracker.promote(0, 2)
+
+	got := tracker.Tiers
+	want := [][]string{{"http://url3", "http://url1", "http://url2", "http://url4"}, {"http://url5"}}
 
 	if !reflect.DeepEqual(got, want) {
 		t.Errorf("got: %v want %v", got, want)
 	}
 }
 
+func TestAnnounceTiers(t *testing.T) {
+	var requested []string
+	handler := func(name string, status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			requested = append(requested, name)
+			w.WriteHeader(status)
+			w.Write([]byte("d8:intervali900ee"))
+		}
+	}
+	dead1 := httptest.NewServer(handler("dead1", http.StatusInternalServerError))
+	defer dead1.Close()
+	dead2 := httptest.NewServer(handler("dead2", http.StatusInternalServerError))
+	defer dead2.Close()
+	alive1 := httptest.NewServer(handler("alive1", http.StatusOK))
+	defer alive1.Close()
+	alive2 := httptest.NewServer(handler("alive2", http.StatusOK))
+	defer alive2.Close()
+
+	tracker := &HttpTracker{Tiers: [][]string{{dead1.URL, dead2.URL}, {dead2.URL, alive1.URL, alive2.URL}, {dead1.URL, alive1.URL}}}
+
+	resp, err := tracker.Announce("a=1", nil, NoRetry)
+	if err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+	if resp.Interval != 900 {
+		t.Errorf("got: %v want %v", resp.Interval, 900)
+	}
+	wantRequested := []string{"dead1", "dead2", "dead2", "alive1"}
+	if !reflect.DeepEqual(requested, wantRequested) {
+		t.Errorf("got: %v want %v", requested, wantRequested)
+	}
+	wantTiers := [][]string{{dead1.URL, dead2.URL}, {alive1.URL, dead2.URL, alive2.URL}, {dead1.URL, alive1.URL}}
+	if !reflect.DeepEqual(tracker.Tiers, wantTiers) {
+		t.Errorf("got: %v want %v", tracker.Tiers, wantTiers)
+	}
+}
+
 func TestHandleSuccessfulResponse(t *testing.T) {
 
 	t.Run("Empty interval should be overided with 1800 ", func(t *testing.T) {
@@ -55,3 +117,274 @@ func TestHandleSuccessfulResponse(t *testing.T) {
 	})
 
 }
+
+func TestDryRunAnnounce(t *testing.T) {
+	tracker, _ := NewHttpTracker(&bencode.TorrentInfo{TrackerInfo: &bencode.TrackerInfo{Urls: []string{"http://url1/announce?passkey=abc"}}})
+	var logs bytes.Buffer
+	tracker.DryRun = &DryRunConfig{Interval: 10, Seeders: 3, Leechers: 7, Logger: log.New(&logs, "", 0)}
+
+	got, err := tracker.Announce("info_hash=x&event=started", map[string]string{"User-Agent": "qBittorrent/5.0.4"}, NoRetry)
+	if err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+	want := &TrackerResponse{Interval: 10, Seeders: 3, Leechers: 7}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v want %v", got, want)
+	}
+
+	wantLogs := "GET http://url1/announce?passkey=abc&info_hash=x&event=started\n\tUser-Agent: qBittorrent/5.0.4\n"
+	if logs.String() != wantLogs {
+		t.Errorf("got: %q want %q", logs.String(), wantLogs)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tracker := &HttpTracker{Tiers: [][]string{{"http://url1", "http://url2"}, {"http://url3"}}}
+
+	t.Run("One tracker per tier", func(t *testing.T) {
+		var got [][][]string
+		for _, split := range tracker.Split(false) {
+			got = append(got, split.Tiers)
+		}
+		want := [][][]string{{{"http://url1", "http://url2"}}, {{"http://url3"}}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got: %v want %v", got, want)
+		}
+	})
+
+	t.Run("One tracker per url", func(t *testing.T) {
+		var got [][][]string
+		for _, split := range tracker.Split(true) {
+			got = append(got, split.Tiers)
+		}
+		want := [][][]string{{{"http://url1"}}, {{"http://url2"}}, {{"http://url3"}}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got: %v want %v", got, want)
+		}
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var requested []string
+	handler := func(name string, status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			requested = append(requested, name)
+			w.WriteHeader(status)
+			w.Write([]byte("d8:intervali900ee"))
+		}
+	}
+	dead := httptest.NewServer(handler("dead", http.StatusInternalServerError))
+	defer dead.Close()
+	alive := httptest.NewServer(handler("alive", http.StatusOK))
+	defer alive.Close()
+
+	tracker := &HttpTracker{Tiers: [][]string{{dead.URL}, {alive.URL}}, BreakerThreshold: 2}
+	for i := 0; i < 3; i++ {
+		tracker.Announce("a=1", nil, NoRetry)
+	}
+
+	want := []string{"dead", "alive", "dead", "alive", "alive"}
+	if !reflect.DeepEqual(requested, want) {
+		t.Errorf("got: %v want %v", requested, want)
+	}
+	health := tracker.Health()
+	if h := health[dead.URL]; h.Failures != 2 || !h.Skipped(time.Now()) || h.LastError != (&HTTPStatusError{URL: dead.URL, StatusCode: 500}).Error() {
+		t.Errorf("dead url should be skipped, got %+v", h)
+	}
+	if h := health[alive.URL]; h.Successes != 3 || h.Skipped(time.Now()) {
+		t.Errorf("alive url should not be skipped, got %+v", h)
+	}
+
+	t.Run("Skipped urls are tried when there is nothing else", func(t *testing.T) {
+		requested = nil
+		tracker := &HttpTracker{Tiers: [][]string{{dead.URL}}, BreakerThreshold: 1}
+		tracker.Announce("a=1", nil, NoRetry)
+		tracker.Announce("a=1", nil, NoRetry)
+		want := []string{"dead", "dead"}
+		if !reflect.DeepEqual(requested, want) {
+			t.Errorf("got: %v want %v", requested, want)
+		}
+	})
+}
+
+func TestAnnounceErrors(t *testing.T) {
+	data := []struct {
+		name      string
+		status    int
+		body      string
+		want      func(url string) error
+		retryable bool
+	}{
+		{
+			name:   "Failure reason with 4xx status",
+			status: http.StatusForbidden,
+			body:   "d14:failure reason20:Unregistered torrente",
+			want: func(url string) error {
+				return &TrackerFailure{URL: url, Reason: "Unregistered torrent"}
+			},
+		},
+		{
+			name:   "Retryable failure reason",
+			status: http.StatusOK,
+			body:   "d14:failure reason12:Rate limitede",
+			want: func(url string) error {
+				return &TrackerFailure{URL: url, Reason: "Rate limited", Retryable: true}
+			},
+			retryable: true,
+		},
+		{
+			name:   "Status without failure reason",
+			status: http.StatusNotFound,
+			body:   "not found",
+			want: func(url string) error {
+				return &HTTPStatusError{URL: url, StatusCode: http.StatusNotFound, Body: "not found"}
+			},
+		},
+		{
+			name:   "Server error",
+			status: http.StatusBadGateway,
+			want: func(url string) error {
+				return &HTTPStatusError{URL: url, StatusCode: http.StatusBadGateway}
+			},
+			retryable: true,
+		},
+		{
+			name:   "Invalid bencode",
+			status: http.StatusOK,
+			body:   "<html>",
+			want: func(url string) error {
+				return &DecodeError{URL: url}
+			},
+			retryable: true,
+		},
+	}
+
+	for _, td := range data {
+		t.Run(td.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(td.status)
+				w.Write([]byte(td.body))
+			}))
+			defer server.Close()
+
+			tracker := &HttpTracker{Tiers: [][]string{{server.URL}}}
+			_, err := tracker.Announce("a=1", nil, NoRetry)
+			want := td.want(server.URL)
+			if decodeErr, ok := err.(*DecodeError); ok {
+				decodeErr.Err = nil
+			}
+			if !reflect.DeepEqual(err, want) {
+				t.Errorf("got: %#v want %#v", err, want)
+			}
+			if IsRetryable(err) != td.retryable {
+				t.Errorf("got retryable %v want %v", IsRetryable(err), td.retryable)
+			}
+		})
+	}
+
+	t.Run("Status with a body not in the announced encoding", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("bad gateway"))
+		}))
+		defer server.Close()
+
+		tracker := &HttpTracker{Tiers: [][]string{{server.URL}}}
+		_, err := tracker.Announce("a=1", nil, NoRetry)
+		want := &HTTPStatusError{URL: server.URL, StatusCode: http.StatusBadGateway, Body: "bad gateway"}
+		if !reflect.DeepEqual(err, want) {
+			t.Errorf("got: %#v want %#v", err, want)
+		}
+	})
+
+	t.Run("Refusal stops the retries", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("d14:failure reason13:Client bannede"))
+		}))
+		defer server.Close()
+
+		tracker := &HttpTracker{Tiers: [][]string{{server.URL}}}
+		_, err := tracker.Announce("a=1", nil, RetryForever)
+		var failure *TrackerFailure
+		if !errors.As(err, &failure) || failure.Retryable {
+			t.Errorf("got: %v want a fatal tracker failure", err)
+		}
+	})
+
+	t.Run("Refusal is preferred over unreachable urls", func(t *testing.T) {
+		refusing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("d14:failure reason13:Client bannede"))
+		}))
+		defer refusing.Close()
+
+		tracker := &HttpTracker{Tiers: [][]string{{refusing.URL}, {"http://127.0.0.1:1"}}}
+		_, err := tracker.Announce("a=1", nil, NoRetry)
+		var failure *TrackerFailure
+		if !errors.As(err, &failure) {
+			t.Errorf("got: %v want a tracker failure", err)
+		}
+	})
+}
+
+func TestAnnounceRedirect(t *testing.T) {
+	var userAgent string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		w.Write([]byte("d8:intervali900ee"))
+	}))
+	defer target.Close()
+	redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+"/announce?"+r.URL.RawQuery, http.StatusFound)
+	}))
+	defer redirecting.Close()
+
+	tracker := &HttpTracker{Tiers: [][]string{{redirecting.URL}}}
+	resp, err := tracker.Announce("a=1", map[string]string{"User-Agent": "qBittorrent/5.0.4"}, NoRetry)
+	if err != nil {
+		t.Fatalf("should not return error: %v", err)
+	}
+	if resp.Interval != 900 || userAgent != "qBittorrent/5.0.4" {
+		t.Errorf("redirect should keep the headers, got interval %v user agent %q", resp.Interval, userAgent)
+	}
+}
+
+func TestAnnounceRetryPolicy(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("d8:intervali900ee"))
+	}))
+	defer server.Close()
+
+	t.Run("Gives up after the max retries", func(t *testing.T) {
+		requests = 0
+		var attempts []int
+		tracker := &HttpTracker{Tiers: [][]string{{server.URL}}}
+		_, err := tracker.Announce("a=1", nil, RetryPolicy{MaxRetries: 1, Delay: time.Millisecond, OnRetry: func(attempt int, err error, delay time.Duration) {
+			attempts = append(attempts, attempt)
+		}})
+		if err == nil {
+			t.Error("should return error")
+		}
+		if requests != 2 || !reflect.DeepEqual(attempts, []int{1}) {
+			t.Errorf("got %v requests and retries %v want %v and %v", requests, attempts, 2, []int{1})
+		}
+	})
+
+	t.Run("Succeeds within the max retries", func(t *testing.T) {
+		requests = 0
+		tracker := &HttpTracker{Tiers: [][]string{{server.URL}}}
+		resp, err := tracker.Announce("a=1", nil, RetryPolicy{MaxRetries: 2, Delay: time.Millisecond})
+		if err != nil {
+			t.Fatalf("should not return error: %v", err)
+		}
+		if resp.Interval != 900 || tracker.RetryAttempt != 0 {
+			t.Errorf("got interval %v retry attempt %v", resp.Interval, tracker.RetryAttempt)
+		}
+	})
+}